@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	// The sqlite driver of the sql storage.
+	_ "modernc.org/sqlite"
+
+	"markets/internal/pkg/config"
+	"markets/pkg/database"
+	"markets/pkg/exchange"
+	"markets/pkg/logging"
+)
+
+// loadConfig loads and validates the config, the problems are printed to stderr.
+func loadConfig(path string, stderr io.Writer) (*config.Config, bool) {
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, false
+	}
+
+	return cfg, true
+}
+
+// selectExchanges returns the configured exchanges in order, or the selected ones if any.
+func selectExchanges(cfg *config.Config, selected []string) ([]string, error) {
+	configured := cfg.GetExchangeNames()
+	if len(selected) == 0 {
+		return configured, nil
+	}
+
+	for _, name := range selected {
+		found := false
+		for _, value := range configured {
+			if value == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, errors.New("exchange " + name + " is not configured")
+		}
+	}
+
+	return selected, nil
+}
+
+// newConnector opens the configured storage.
+func newConnector(cfg *config.Config, logs *logging.Logging) (database.Connector, error) {
+	storageOptions := cfg.GetStorageConfig().Options()
+	if logs != nil {
+		storageOptions.Logger = logs.Logger("database")
+	}
+
+	return database.NewConnector(storageOptions)
+}
+
+// newExchange creates the exchange of the name with its config, the loggers are set if logs is not nil,
+// and its activity is counted if the metrics are not nil.
+func newExchange(cfg *config.Config, name string, interactor *database.Interactor, logs *logging.Logging,
+	exchangeMetrics *exchange.Metrics) (exchange.Exchanger, error) {
+	exchangeConfig, err := cfg.GetExchangeConfig(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var e interface {
+		exchange.Exchanger
+		SetLogger(logger *slog.Logger)
+		SetWebsocketLogger(logger *slog.Logger)
+		SetMetrics(m *exchange.Metrics)
+	}
+
+	switch name {
+	case "okx":
+		e, err = exchange.NewOkx(exchangeConfig.Settings(), exchangeConfig.Currencies, interactor)
+	case "gateio":
+		e, err = exchange.NewGateio(exchangeConfig.Settings(), exchangeConfig.Currencies, interactor)
+	default:
+		return nil, errors.New("unsupported exchange " + name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if logs != nil {
+		e.SetLogger(logs.Logger("exchange"))
+		e.SetWebsocketLogger(logs.Logger("wsclt"))
+	}
+
+	e.SetMetrics(exchangeMetrics)
+
+	return e, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"markets/pkg/database"
+	"markets/pkg/exchange"
+)
+
+type exchangeHealth struct {
+	Running   bool     `json:"running"`
+	Connected bool     `json:"connected"`
+	LoggedIn  bool     `json:"loggedIn"`
+	Channels  []string `json:"channels"`
+	// LastMessageAge is empty if nothing has been received yet.
+	LastMessageAge string          `json:"lastMessageAge,omitempty"`
+	OrderBooks     map[string]bool `json:"orderBooks,omitempty"`
+	Ready          bool            `json:"ready"`
+	// Restarts is the number of times the supervisor has started the exchange again, LastRestart tells why.
+	Restarts    int            `json:"restarts"`
+	LastRestart *restartHealth `json:"lastRestart,omitempty"`
+}
+
+type restartHealth struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+type storageHealth struct {
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Status    string                    `json:"status"`
+	Storage   storageHealth             `json:"storage"`
+	Exchanges map[string]exchangeHealth `json:"exchanges"`
+}
+
+// healthHandler serves /healthz, which fails once the supervisor has stopped, and /readyz,
+// which fails until every exchange is ready and the storage is reachable.
+// A failed exchange is restarted by the supervisor, so it makes the process unready but not dead.
+type healthHandler struct {
+	supervisor *exchange.Supervisor
+	exchanges  map[string]exchange.Exchanger
+	connector  database.Connector
+	// maxMessageAge makes an exchange unready if nothing has been received for longer, it is disabled if it is 0.
+	maxMessageAge time.Duration
+}
+
+func newHealthHandler(supervisor *exchange.Supervisor, exchanges map[string]exchange.Exchanger, connector database.Connector,
+	maxMessageAge time.Duration) http.Handler {
+	h := &healthHandler{
+		supervisor:    supervisor,
+		exchanges:     exchanges,
+		connector:     connector,
+		maxMessageAge: maxMessageAge,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.serveLiveness)
+	mux.HandleFunc("/readyz", h.serveReadiness)
+
+	return mux
+}
+
+// report collects the state of the exchanges and the storage, it tells whether all of them are alive and ready.
+func (h *healthHandler) report() (report healthReport, alive bool, ready bool) {
+	alive, ready = h.supervisor.IsSupervising(), true
+	report.Exchanges = make(map[string]exchangeHealth, len(h.exchanges))
+
+	if err := database.PingConnector(h.connector); err != nil {
+		report.Storage.Error = err.Error()
+		ready = false
+	} else {
+		report.Storage.Reachable = true
+	}
+
+	now := time.Now()
+
+	for name, e := range h.exchanges {
+		// The exchanges which don't report their health are not checked.
+		reporter, ok := e.(exchange.HealthReporter)
+		if !ok {
+			continue
+		}
+
+		health := reporter.Health()
+		result := exchangeHealth{
+			Running:    health.Running,
+			Connected:  health.Connected,
+			LoggedIn:   health.LoggedIn,
+			Channels:   health.Channels,
+			OrderBooks: health.OrderBooks,
+			Ready:      health.Ready(),
+		}
+
+		if !health.LastMessage.IsZero() {
+			age := now.Sub(health.LastMessage)
+			result.LastMessageAge = age.Round(time.Millisecond).String()
+
+			if h.maxMessageAge > 0 && age > h.maxMessageAge {
+				result.Ready = false
+			}
+		} else if h.maxMessageAge > 0 {
+			result.Ready = false
+		}
+
+		restarts, total := h.supervisor.Restarts(name)
+		result.Restarts = total
+		if len(restarts) > 0 {
+			last := restarts[len(restarts)-1]
+			result.LastRestart = &restartHealth{Time: last.Time, Error: last.Error.Error()}
+		}
+
+		if !result.Ready {
+			ready = false
+		}
+
+		report.Exchanges[name] = result
+	}
+
+	return report, alive, ready
+}
+
+func (h *healthHandler) serveLiveness(w http.ResponseWriter, _ *http.Request) {
+	report, alive, _ := h.report()
+	writeHealthReport(w, report, alive)
+}
+
+func (h *healthHandler) serveReadiness(w http.ResponseWriter, _ *http.Request) {
+	report, _, ready := h.report()
+	writeHealthReport(w, report, ready)
+}
+
+func writeHealthReport(w http.ResponseWriter, report healthReport, ok bool) {
+	status := http.StatusOK
+	report.Status = "ok"
+	if !ok {
+		status = http.StatusServiceUnavailable
+		report.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"markets/pkg/database"
+	"markets/pkg/exchange"
+	"markets/pkg/exchange/exchangetest"
+)
+
+func getHealth(t *testing.T, handler http.Handler, path string) (int, healthReport) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report healthReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Health Error: unexpected body '%s': %v", recorder.Body.String(), err)
+	}
+
+	return recorder.Code, report
+}
+
+func TestHealthHandler(t *testing.T) {
+	server := exchangetest.NewGateioServer()
+	defer server.Close()
+
+	connector, err := database.NewBoltConnector(filepath.Join(t.TempDir(), "markets.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gateio, err := exchange.NewGateio(
+		&exchange.Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
+		},
+		[]string{"BTC/USDT"},
+		database.NewInteractor(connector),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	supervisor := exchange.NewSupervisor(nil)
+	supervisor.Add("gateio", gateio)
+
+	handler := newHealthHandler(supervisor, map[string]exchange.Exchanger{"gateio": gateio}, connector, time.Minute)
+
+	// Nothing is alive or ready before the exchange starts.
+	if code, report := getHealth(t, handler, "/readyz"); code != http.StatusServiceUnavailable || report.Exchanges["gateio"].Ready {
+		t.Errorf("Health Error: expected the exchange not to be ready before it starts, got %d %+v", code, report)
+	}
+	if code, _ := getHealth(t, handler, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Health Error: expected nothing to be alive before the supervisor starts, got %d", code)
+	}
+
+	if err := supervisor.Start(); err != nil {
+		t.Fatal("Can't start the supervisor:", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, report := getHealth(t, handler, "/readyz")
+		if code == http.StatusOK {
+			health := report.Exchanges["gateio"]
+			if report.Status != "ok" || !report.Storage.Reachable || !health.Connected || !health.LoggedIn ||
+				!health.OrderBooks["BTC/USDT"] || health.LastMessageAge == "" || len(health.Channels) != 3 ||
+				health.Restarts != 0 || health.LastRestart != nil {
+				t.Errorf("Health Error: unexpected report %+v", report)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Health Error: the exchange is not ready, got %+v", report)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if code, _ := getHealth(t, handler, "/healthz"); code != http.StatusOK {
+		t.Errorf("Health Error: expected the running exchange to be alive, got %d", code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := supervisor.Stop(ctx); err != nil {
+		t.Error("Can't stop the supervisor:", err)
+	}
+
+	if code, report := getHealth(t, handler, "/healthz"); code != http.StatusServiceUnavailable || report.Exchanges["gateio"].Running {
+		t.Errorf("Health Error: expected the stopped exchange not to be alive, got %d %+v", code, report)
+	}
+
+	if err := connector.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, report := getHealth(t, handler, "/readyz"); code != http.StatusServiceUnavailable || report.Storage.Reachable ||
+		report.Storage.Error == "" {
+		t.Errorf("Health Error: expected the closed storage to be unreachable, got %d %+v", code, report)
+	}
+}
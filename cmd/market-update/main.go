@@ -1,79 +1,110 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+)
 
-	"github.com/go-redis/redis/v8"
-
-	"markets/internal/pkg/config"
-	"markets/pkg/database"
-	"markets/pkg/exchange"
+// The exit codes of the commands.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
 )
 
-func pollExchange(e exchange.Exchanger) {
-	forever := make(chan bool)
+const defaultConfigPath = "configs/config.yaml"
 
-	if err := e.Start(); err != nil {
-		panic(err)
+type command struct {
+	name    string
+	usage   string
+	execute func(args []string, stdout io.Writer, stderr io.Writer) int
+}
+
+var commands = []*command{
+	{
+		name:    "run",
+		usage:   "run [--config path] [--exchange name,...]\n\tPoll the exchanges and store the data, all configured exchanges are polled by default.",
+		execute: runCommand,
+	},
+	{
+		name:    "validate-config",
+		usage:   "validate-config [--config path]\n\tReport all problems of the config.",
+		execute: validateConfigCommand,
+	},
+	{
+		name:    "show",
+		usage:   "show orderbook|balance|order|fee --exchange name [--currency currency] [--id order] [--config path]\n\tPrint the stored data as JSON, everything of the exchange is printed if the currency is omitted.",
+		execute: showCommand,
+	},
+	{
+		name:    "ping",
+		usage:   "ping [--config path] [--exchange name,...]\n\tCheck the credentials of the exchanges with an authenticated request.",
+		execute: pingCommand,
+	},
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: market-update <command> [options]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintln(w, "  "+c.usage)
 	}
+}
 
-	defer func() {
-		if err := e.Stop(); err != nil {
-			panic(err)
-		}
-	}()
+// exchangeList is a flag accepting the names separated by commas or repeated, e.g. --exchange okx --exchange gateio.
+type exchangeList []string
 
-	<-forever
+func (l *exchangeList) String() string {
+	return strings.Join(*l, ",")
 }
 
-func main() {
-	dataBytes, err := os.ReadFile("configs/config.yaml")
-	if err != nil {
-		panic(err)
+func (l *exchangeList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*l = append(*l, name)
+		}
 	}
 
-	cfg := config.Config{}
+	return nil
+}
 
-	if err := cfg.Load(dataBytes); err != nil {
-		panic(err)
-	}
+// newFlagSet creates the flags of the command, the errors are reported by the command.
+func newFlagSet(name string, stderr io.Writer) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", defaultConfigPath, "the path of the config file")
 
-	var currencies []string
+	return flags, configPath
+}
 
-	if value, err := cfg.GetCurrenciesSetting(); err != nil {
-		panic(err)
-	} else {
-		currencies = value
+// execute runs the command named by the first argument and returns the exit code.
+func execute(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
 	}
 
-	if setting, err := cfg.GetExchangeSetting("okx"); err != nil {
-		panic(err)
-	} else {
-		e := exchange.NewOkx(
-			setting,
-			currencies,
-			database.NewInteractor(database.NewRedisConnector(&redis.Options{
-				Addr: "localhost:6379",
-			})),
-		)
-
-		go pollExchange(e)
+	switch args[0] {
+	case "help", "-h", "--help":
+		printUsage(stdout)
+		return exitOK
 	}
 
-	if setting, err := cfg.GetExchangeSetting("gateio"); err != nil {
-		panic(err)
-	} else {
-		e := exchange.NewGateio(
-			setting,
-			currencies,
-			database.NewInteractor(database.NewRedisConnector(&redis.Options{
-				Addr: "localhost:6379",
-			})),
-		)
-
-		go pollExchange(e)
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.execute(args[1:], stdout, stderr)
+		}
 	}
 
-	forever := make(chan bool)
-	<-forever
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return exitUsage
+}
+
+func main() {
+	os.Exit(execute(os.Args[1:], os.Stdout, os.Stderr))
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"markets/pkg/database"
+	"markets/pkg/exchange/exchangetest"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func executeCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := execute(args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExecute(t *testing.T) {
+	if code, _, stderr := executeCommand(); code != exitUsage || !strings.Contains(stderr, "Usage:") {
+		t.Errorf("Execute Error: expected the usage, got %d '%s'", code, stderr)
+	}
+
+	if code, _, _ := executeCommand("poll"); code != exitUsage {
+		t.Errorf("Execute Error: expected %d for the unknown command, got %d", exitUsage, code)
+	}
+
+	if code, _, _ := executeCommand("run", "--unknown"); code != exitUsage {
+		t.Errorf("Execute Error: expected %d for the unknown flag, got %d", exitUsage, code)
+	}
+
+	valid := writeConfig(t, "exchange:\n  gateio:\n    apiKey: 123456\n    secret: 123456\ncurrency:\n  - BTC/USDT\n")
+	if code, stdout, _ := executeCommand("validate-config", "--config", valid); code != exitOK || !strings.Contains(stdout, "is valid") {
+		t.Errorf("Execute Error: expected the config to be valid, got %d '%s'", code, stdout)
+	}
+
+	invalid := writeConfig(t, "exchange:\n  okx:\n    apiKey: 123456\n    secret: 123456\ncurrency:\n  - BTC/USDT\n")
+	if code, _, stderr := executeCommand("validate-config", "--config", invalid); code != exitFailure ||
+		!strings.Contains(stderr, "exchange.okx.password: is required") {
+		t.Errorf("Execute Error: expected the problems of the config, got %d '%s'", code, stderr)
+	}
+
+	if code, _, _ := executeCommand("run", "--config", valid, "--exchange", "okx"); code != exitUsage {
+		t.Errorf("Execute Error: expected %d for the exchange which is not configured, got %d", exitUsage, code)
+	}
+}
+
+func TestExecute_Show(t *testing.T) {
+	storagePath := filepath.Join(t.TempDir(), "markets.db")
+
+	connector, err := database.NewBoltConnector(storagePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.NewInteractor(connector).SetBalance("gateio", "USDT", &database.Balance{Free: 10, Used: 5, Total: 15}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := connector.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeConfig(t, "exchange:\n  gateio:\n    apiKey: 123456\n    secret: 123456\ncurrency:\n  - BTC/USDT\n"+
+		"storage:\n  type: bolt\n  bolt:\n    path: "+storagePath+"\n")
+
+	code, stdout, stderr := executeCommand("show", "balance", "--config", path, "--exchange", "gateio", "--currency", "USDT")
+	if code != exitOK {
+		t.Fatalf("Show Error: %d '%s'", code, stderr)
+	}
+
+	var balance database.Balance
+	if err := json.Unmarshal([]byte(stdout), &balance); err != nil || balance.Total != 15 {
+		t.Errorf("Show Error: unexpected balance '%s', %v", stdout, err)
+	}
+
+	if code, _, _ := executeCommand("show", "orderbook", "--config", path, "--exchange", "gateio", "--currency", "BTC/USDT"); code != exitFailure {
+		t.Errorf("Show Error: expected %d for the missing order book, got %d", exitFailure, code)
+	}
+
+	if code, _, _ := executeCommand("show", "trades", "--config", path, "--exchange", "gateio"); code != exitUsage {
+		t.Errorf("Show Error: expected %d for the unknown data, got %d", exitUsage, code)
+	}
+}
+
+func TestExecute_Ping(t *testing.T) {
+	okx := exchangetest.NewOkxServer()
+	defer okx.Close()
+
+	gateio := exchangetest.NewGateioServer()
+	defer gateio.Close()
+
+	path := writeConfig(t, `
+exchange:
+  okx:
+    apiKey: 123456
+    secret: 123456
+    password: 123456
+    websocketApiUrl: `+okx.URL+`
+    restApiUrl: `+okx.RestURL+`
+  gateio:
+    apiKey: 123456
+    secret: 123456
+    websocketApiUrl: `+gateio.URL+`
+    restApiUrl: `+gateio.RestURL+`
+currency:
+  - BTC/USDT
+`)
+
+	if code, stdout, stderr := executeCommand("ping", "--config", path); code != exitOK || stdout != "okx: ok\ngateio: ok\n" {
+		t.Errorf("Ping Error: %d '%s' '%s'", code, stdout, stderr)
+	}
+
+	// The fake exchange answers 404 to the requests which are not scripted.
+	unreachable := exchangetest.NewServer(&exchangetest.Script{})
+	defer unreachable.Close()
+
+	path = writeConfig(t, "exchange:\n  gateio:\n    apiKey: 123456\n    secret: 123456\n    restApiUrl: "+unreachable.RestURL+
+		"\ncurrency:\n  - BTC/USDT\n")
+
+	if code, _, stderr := executeCommand("ping", "--config", path, "--exchange", "gateio"); code != exitFailure ||
+		!strings.Contains(stderr, "gateio: 404") {
+		t.Errorf("Ping Error: expected the rejected request, got %d '%s'", code, stderr)
+	}
+}
+
+func TestExecute_Run(t *testing.T) {
+	gateio := exchangetest.NewGateioServer()
+	defer gateio.Close()
+
+	// Reserve a free port for the probes.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	path := writeConfig(t, "exchange:\n  gateio:\n    apiKey: 123456\n    secret: 123456\n    websocketApiUrl: "+gateio.URL+
+		"\n    restApiUrl: "+gateio.RestURL+"\ncurrency:\n  - BTC/USDT\nstorage:\n  type: bolt\n  bolt:\n    path: "+
+		filepath.Join(t.TempDir(), "markets.db")+"\nretention:\n  interval: 10ms\n  dropZeroBalances: true\n")
+
+	result := make(chan int, 1)
+	go func() {
+		code, _, _ := executeCommand("run", "--config", path, "--http-address", address)
+		result <- code
+	}()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get("http://" + address + path)
+		if err != nil {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if code, _ := get("/readyz"); code == http.StatusOK {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Run Error: the exchanges are not ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if code, body := get("/metrics"); code != http.StatusOK ||
+		!strings.Contains(body, `markets_exchange_updates_total{exchange="gateio",channel="spot.order_book_update"}`) ||
+		!strings.Contains(body, `markets_storage_write_duration_seconds_count{region="OrderBook"}`) {
+		t.Errorf("Run Error: unexpected metrics %d '%s'", code, body)
+	}
+
+	// The janitor is started with the exchanges and its runs are exported.
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		if _, body := get("/metrics"); strings.Contains(body, `markets_storage_retention_runs_total{policy="drop_zero_balances"}`) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Run Error: the retention policies are not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The process stops gracefully on SIGINT.
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case code := <-result:
+		if code != exitOK {
+			t.Errorf("Run Error: expected %d after the graceful shutdown, got %d", exitOK, code)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("Run Error: the process has not stopped")
+	}
+}
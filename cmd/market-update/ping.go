@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"markets/pkg/database"
+)
+
+// pingCommand checks the credentials of every selected exchange, it fails if any of them is rejected.
+func pingCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags, configPath := newFlagSet("ping", stderr)
+	var selected exchangeList
+	flags.Var(&selected, "exchange", "the exchanges to check, separated by commas")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, ok := loadConfig(*configPath, stderr)
+	if !ok {
+		return exitFailure
+	}
+
+	names, err := selectExchanges(cfg, selected)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	// Nothing is stored by the requests, so the storage is not opened.
+	interactor := database.NewInteractor(database.NewInternalConnector())
+
+	code := exitOK
+	for _, name := range names {
+		e, err := newExchange(cfg, name, interactor, nil, nil)
+		if err == nil {
+			err = e.Ping()
+		}
+
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", name, cfg.Redact(err.Error()))
+			code = exitFailure
+		} else {
+			fmt.Fprintf(stdout, "%s: ok\n", name)
+		}
+	}
+
+	return code
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"markets/internal/pkg/config"
+	"markets/pkg/database"
+	"markets/pkg/exchange"
+	"markets/pkg/logging"
+	"markets/pkg/metrics"
+)
+
+// subscriptions are the subscribed currencies keyed by exchange name, they are read by the janitor
+// while the config is reloaded.
+type subscriptions struct {
+	mux        sync.Mutex
+	currencies map[string][]string
+}
+
+func (s *subscriptions) set(name string, currencies []string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.currencies == nil {
+		s.currencies = make(map[string][]string)
+	}
+	s.currencies[name] = append([]string(nil), currencies...)
+}
+
+func (s *subscriptions) get() map[string][]string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	result := make(map[string][]string, len(s.currencies))
+	for name, currencies := range s.currencies {
+		result[name] = append([]string(nil), currencies...)
+	}
+
+	return result
+}
+
+// defaultShutdownTimeout is how long the exchanges are given to stop on SIGINT or SIGTERM.
+const defaultShutdownTimeout = 10 * time.Second
+
+// runCommand polls the exchanges until SIGINT or SIGTERM, then shuts them down gracefully.
+// The exchanges which fail are started again by the supervisor, the others keep running.
+// It returns exitFailure if the shutdown has not completed in time.
+func runCommand(args []string, _ io.Writer, stderr io.Writer) int {
+	flags, configPath := newFlagSet("run", stderr)
+	var selected exchangeList
+	flags.Var(&selected, "exchange", "the exchanges to poll, separated by commas")
+	shutdownTimeout := flags.Duration("shutdown-timeout", defaultShutdownTimeout, "how long the exchanges are given to stop")
+	httpAddress := flags.String("http-address", "", "the address of /healthz, /readyz and /metrics, e.g. :8080, they are disabled if it is empty")
+	maxMessageAge := flags.Duration("max-message-age", 0, "an exchange is not ready if nothing has been received for longer, 0 disables the check")
+	minBackoff := flags.Duration("restart-min-backoff", time.Second, "the delay before a failed exchange is started again")
+	maxBackoff := flags.Duration("restart-max-backoff", time.Minute, "the delay doubles after every failure up to this value")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, ok := loadConfig(*configPath, stderr)
+	if !ok {
+		return exitFailure
+	}
+
+	names, err := selectExchanges(cfg, selected)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	logs, err := logging.New(cfg.GetLogSetting().Options())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	defer logs.Close()
+
+	logger := logs.Logger("main")
+
+	// All exchanges share a single connector.
+	connector, err := newConnector(cfg, logs)
+	if err != nil {
+		logger.Error("can't open the storage", "error", err)
+		return exitFailure
+	}
+
+	registry := metrics.NewRegistry()
+	exchangeMetrics := exchange.NewMetrics(registry)
+	interactor := database.NewInteractor(connector, database.WithMetrics(database.NewMetrics(registry)))
+
+	supervisor := exchange.NewSupervisor(&exchange.SupervisorOptions{
+		MinBackoff: *minBackoff,
+		MaxBackoff: *maxBackoff,
+		Metrics:    exchangeMetrics,
+		Logger:     logs.Logger("exchange"),
+	})
+
+	var subscribed subscriptions
+	exchanges := make(map[string]exchange.Exchanger, len(names))
+	for _, name := range names {
+		if e, err := newExchange(cfg, name, interactor, logs, exchangeMetrics); err != nil {
+			logger.Error("can't create the exchange", logging.KeyExchange, name, "error", err)
+			_ = database.CloseConnector(connector)
+			return exitFailure
+		} else {
+			exchanges[name] = e
+			supervisor.Add(name, e)
+		}
+
+		if exchangeConfig, err := cfg.GetExchangeConfig(name); err == nil {
+			subscribed.set(name, exchangeConfig.Currencies)
+		}
+	}
+
+	// The retention policies prune the storage in background while the exchanges are running.
+	var janitor *database.Janitor
+	if retention := cfg.GetRetentionConfig(); retention != nil {
+		janitor = database.NewJanitor(interactor, retention.GetInterval(), retention.Policies(subscribed.get)...)
+	}
+
+	// The probes and the metrics are served while the exchanges start, they are not ready until then.
+	if *httpAddress != "" {
+		listener, err := net.Listen("tcp", *httpAddress)
+		if err != nil {
+			logger.Error("can't listen for the health checks and the metrics", "address", *httpAddress, "error", err)
+			_ = database.CloseConnector(connector)
+			return exitFailure
+		}
+
+		health := newHealthHandler(supervisor, exchanges, connector, *maxMessageAge)
+
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", health)
+		mux.Handle("/readyz", health)
+		mux.Handle("/metrics", registry.Handler())
+
+		server := &http.Server{Handler: mux}
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("can't serve the health checks and the metrics", "error", err)
+			}
+		}()
+		defer server.Close()
+
+		logger.Info("serving the health checks and the metrics", "address", listener.Addr().String())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The exchanges are started in the background, the ones which can't start are retried.
+	if err := supervisor.Start(); err != nil {
+		logger.Error("can't start the exchanges", "error", err)
+		_ = shutdownWithTimeout(supervisor, connector, logger, *shutdownTimeout)
+		return exitFailure
+	}
+
+	if janitor != nil {
+		janitor.Start()
+	}
+
+	// The currencies are updated without reconnecting when the config file changes or on SIGHUP.
+	watcher := config.NewWatcher(*configPath, &config.WatcherOptions{
+		OnReload: func(cfg *config.Config) {
+			for name, e := range exchanges {
+				if exchangeConfig, err := cfg.GetExchangeConfig(name); err != nil {
+					logger.Error("can't reload the exchange", logging.KeyExchange, name, "error", err)
+				} else if err := e.UpdateCurrencies(exchangeConfig.Currencies); err != nil {
+					logger.Error("can't update the currencies", logging.KeyExchange, name, "error", err)
+				} else {
+					subscribed.set(name, exchangeConfig.Currencies)
+				}
+			}
+		},
+		OnError: func(err error) {
+			logger.Error("can't reload the config", "error", err)
+		},
+	})
+
+	if err := watcher.Start(); err != nil {
+		logger.Error("can't watch the config", "error", err)
+		stopJanitor(janitor)
+		_ = shutdownWithTimeout(supervisor, connector, logger, *shutdownTimeout)
+		return exitFailure
+	}
+
+	<-ctx.Done()
+	// A second signal kills the process if the shutdown hangs.
+	stop()
+
+	logger.Info("shutting down", "timeout", *shutdownTimeout)
+	watcher.Stop()
+	// The janitor is stopped first, so it does not write to the storage while it is closed.
+	stopJanitor(janitor)
+
+	if err := shutdownWithTimeout(supervisor, connector, logger, *shutdownTimeout); err != nil {
+		logger.Error("the shutdown has not completed", "error", err)
+		return exitFailure
+	}
+
+	logger.Info("the shutdown has completed")
+	return exitOK
+}
+
+// stopJanitor waits for the running policies to finish, it does nothing if the retention is disabled.
+func stopJanitor(janitor *database.Janitor) {
+	if janitor != nil {
+		janitor.Stop()
+	}
+}
+
+// shutdownWithTimeout shuts down the exchanges and the storage within the timeout.
+func shutdownWithTimeout(supervisor *exchange.Supervisor, connector database.Connector, logger *slog.Logger, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return shutdown(ctx, supervisor, connector, logger)
+}
+
+// validateConfigCommand reports all problems of the config at once.
+func validateConfigCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags, configPath := newFlagSet("validate-config", stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if _, ok := loadConfig(*configPath, stderr); !ok {
+		return exitFailure
+	}
+
+	fmt.Fprintln(stdout, *configPath+" is valid")
+	return exitOK
+}
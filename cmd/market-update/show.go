@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"markets/pkg/database"
+)
+
+// showData reads the kind of data of the exchange, everything of the exchange is read if the currency is empty.
+func showData(interactor *database.Interactor, kind string, exchangeName string, currency string, orderId string) (interface{}, error) {
+	switch kind {
+	case "orderbook":
+		if currency == "" {
+			return interactor.ListOrderBooks(exchangeName, "")
+		}
+
+		return interactor.GetOrderBook(exchangeName, currency)
+	case "balance":
+		if currency == "" {
+			return interactor.ListBalances(exchangeName, "")
+		}
+
+		return interactor.GetBalance(exchangeName, currency)
+	case "fee":
+		if currency == "" {
+			return interactor.ListFees(exchangeName, "")
+		}
+
+		return interactor.GetFee(exchangeName, currency)
+	case "order":
+		if currency == "" {
+			return nil, errors.New("the currency of the orders is required")
+		}
+
+		if orderId == "" {
+			return interactor.ListOrders(exchangeName, currency)
+		}
+
+		return interactor.GetOrder(exchangeName, currency, orderId)
+	default:
+		return nil, errors.New("unknown data " + kind + ", expected orderbook, balance, order or fee")
+	}
+}
+
+// showCommand prints the stored data of the exchange from the configured storage.
+func showCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "show requires orderbook, balance, order or fee")
+		return exitUsage
+	}
+
+	kind := args[0]
+
+	flags, configPath := newFlagSet("show", stderr)
+	exchangeName := flags.String("exchange", "", "the name of the exchange")
+	currency := flags.String("currency", "", "the currency, e.g. BTC/USDT")
+	orderId := flags.String("id", "", "the id of the order")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+
+	if *exchangeName == "" {
+		fmt.Fprintln(stderr, "--exchange is required")
+		return exitUsage
+	}
+
+	switch kind {
+	case "orderbook", "balance", "order", "fee":
+	default:
+		fmt.Fprintf(stderr, "unknown data %q, expected orderbook, balance, order or fee\n", kind)
+		return exitUsage
+	}
+
+	cfg, ok := loadConfig(*configPath, stderr)
+	if !ok {
+		return exitFailure
+	}
+
+	connector, err := newConnector(cfg, nil)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	defer database.CloseConnector(connector)
+
+	data, err := showData(database.NewInteractor(connector), kind, *exchangeName, *currency, *orderId)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	return exitOK
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"markets/pkg/database"
+	"markets/pkg/exchange"
+)
+
+// shutdown stops the supervisor, which stops the exchanges in parallel, then flushes and closes the storage.
+// It stops waiting for the exchanges once the context is done, the storage is closed anyway
+// so the written data is flushed, and the exchanges which have not stopped are reported.
+func shutdown(ctx context.Context, supervisor *exchange.Supervisor, connector database.Connector, logger *slog.Logger) error {
+	var errs []error
+
+	if err := supervisor.Stop(ctx); err != nil {
+		logger.Error("can't stop the exchanges", "error", err)
+		errs = append(errs, err)
+	}
+
+	if err := database.CloseConnector(connector); err != nil {
+		logger.Error("can't close the storage", "error", err)
+		errs = append(errs, fmt.Errorf("storage: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"markets/pkg/database"
+	"markets/pkg/exchange"
+	"markets/pkg/exchange/exchangetest"
+)
+
+// blockingExchange never finishes stopping.
+type blockingExchange struct {
+	stop chan struct{}
+}
+
+func (e *blockingExchange) Start() error                    { return nil }
+func (e *blockingExchange) Stop() error                     { <-e.stop; return nil }
+func (e *blockingExchange) UpdateCurrencies([]string) error { return nil }
+func (e *blockingExchange) Ping() error                     { return nil }
+
+// failingExchange can't be stopped.
+type failingExchange struct{}
+
+func (failingExchange) Start() error                    { return nil }
+func (failingExchange) Stop() error                     { return errors.New("connection reset") }
+func (failingExchange) UpdateCurrencies([]string) error { return nil }
+func (failingExchange) Ping() error                     { return nil }
+
+func TestShutdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := exchangetest.NewGateioServer()
+	defer server.Close()
+
+	connector, err := database.NewBoltConnector(filepath.Join(t.TempDir(), "markets.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interactor := database.NewInteractor(connector)
+	gateio, err := exchange.NewGateio(
+		&exchange.Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
+		},
+		[]string{"BTC/USDT"},
+		interactor,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	supervisor := exchange.NewSupervisor(&exchange.SupervisorOptions{Logger: logger})
+	supervisor.Add("gateio", gateio)
+
+	if err := supervisor.Start(); err != nil {
+		t.Fatal("Can't start the supervisor:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := shutdown(ctx, supervisor, connector, logger); err != nil {
+		t.Errorf("Shutdown Error: %v", err)
+	}
+
+	if gateio.IsRunning() {
+		t.Error("Shutdown Error: gateio is still running")
+	}
+
+	if err := interactor.SetBalance("gateio", "USDT", &database.Balance{}); err == nil {
+		t.Error("Shutdown Error: the storage is still open")
+	}
+}
+
+func TestShutdown_Timeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	blocking := &blockingExchange{stop: make(chan struct{})}
+	defer close(blocking.stop)
+
+	connector, err := database.NewBoltConnector(filepath.Join(t.TempDir(), "markets.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	supervisor := exchange.NewSupervisor(&exchange.SupervisorOptions{Logger: logger})
+	supervisor.Add("okx", blocking)
+	supervisor.Add("gateio", failingExchange{})
+
+	if err := supervisor.Start(); err != nil {
+		t.Fatal("Can't start the supervisor:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = shutdown(ctx, supervisor, connector, logger)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown Error: expected the deadline to be exceeded, got %v", err)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "[okx]") || !strings.Contains(err.Error(), "gateio: connection reset") {
+		t.Errorf("Shutdown Error: expected the exchanges which have not stopped, got %v", err)
+	}
+
+	// The storage is flushed and closed even though an exchange has not stopped.
+	if err := database.NewInteractor(connector).SetBalance("okx", "USDT", &database.Balance{}); err == nil {
+		t.Error("Shutdown Error: the storage is still open")
+	}
+}
@@ -2,35 +2,149 @@ package config
 
 import (
 	"errors"
+	"log/slog"
+	"path/filepath"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
+
+	"markets/pkg/exchange"
+	"markets/pkg/logging"
 )
 
+// ExchangeConfig is the setting of an exchange.
+type ExchangeConfig struct {
+	ApiKey string `yaml:"apiKey"`
+	Secret string `yaml:"secret"`
+	// Password is the passphrase of the API key, it is required by OKX.
+	Password string `yaml:"password,omitempty"`
+	// Proxy is the address of the HTTP CONNECT or SOCKS5 proxy.
+	Proxy string `yaml:"proxy,omitempty"`
+	// WebsocketApiUrl and RestApiUrl override the schemes and the hosts of the APIs.
+	WebsocketApiUrl string `yaml:"websocketApiUrl,omitempty"`
+	RestApiUrl      string `yaml:"restApiUrl,omitempty"`
+	// PingInterval is the interval of the heartbeats, e.g. 25s.
+	PingInterval time.Duration `yaml:"pingInterval,omitempty"`
+	// MaxSubscriptionsPerConnection limits the order books subscribed on a single connection.
+	MaxSubscriptionsPerConnection int `yaml:"maxSubscriptionsPerConnection,omitempty"`
+	// Channels are the subscribed channels, all channels are subscribed if it is empty.
+	Channels []string `yaml:"channels,omitempty"`
+	// Currencies override the currencies of the config for this exchange.
+	Currencies []string `yaml:"currencies,omitempty"`
+}
+
+// Settings converts the config to the settings accepted by the constructors of the exchanges.
+func (e *ExchangeConfig) Settings() *exchange.Settings {
+	return &exchange.Settings{
+		ApiKey:                        e.ApiKey,
+		Secret:                        e.Secret,
+		Password:                      e.Password,
+		Proxy:                         e.Proxy,
+		WebsocketApiURL:               e.WebsocketApiUrl,
+		RestApiURL:                    e.RestApiUrl,
+		PingInterval:                  e.PingInterval,
+		MaxSubscriptionsPerConnection: e.MaxSubscriptionsPerConnection,
+		Channels:                      append([]string(nil), e.Channels...),
+	}
+}
+
+// LogConfig is the setting of the logs, they are written to the standard error unless they are enabled.
+type LogConfig struct {
+	// Enabled writes the logs to market-update.log under Path.
+	Enabled bool   `yaml:"enable"`
+	Path    string `yaml:"path"`
+	// Format is text or json, text by default.
+	Format string `yaml:"format,omitempty"`
+	// Level is debug, info, warn or error, info by default.
+	Level string `yaml:"level,omitempty"`
+	// Levels override the level of the components, e.g. {wsclt: debug}.
+	Levels map[string]string `yaml:"levels,omitempty"`
+	// MaxSize is the size of the file in megabytes which triggers the rotation, 100 by default.
+	MaxSize int `yaml:"maxSize,omitempty"`
+	// RotateInterval rotates the file periodically, e.g. 24h.
+	RotateInterval time.Duration `yaml:"rotateInterval,omitempty"`
+	// MaxBackups is the number of rotated files kept, all of them are kept if it is 0.
+	MaxBackups int `yaml:"maxBackups,omitempty"`
+}
+
+// Options converts the config to the options accepted by logging.New, the invalid levels are
+// reported by Validate and regarded as info here.
+func (l LogConfig) Options() *logging.Options {
+	options := &logging.Options{
+		Format: l.Format,
+		Levels: make(map[string]slog.Level, len(l.Levels)),
+	}
+
+	options.Level, _ = logging.ParseLevel(l.Level)
+	for component, value := range l.Levels {
+		options.Levels[component], _ = logging.ParseLevel(value)
+	}
+
+	if l.Enabled {
+		options.File = filepath.Join(l.Path, "market-update.log")
+		options.Rotate = logging.RotateOptions{
+			MaxSize:    int64(l.MaxSize) * 1024 * 1024,
+			Interval:   l.RotateInterval,
+			MaxBackups: l.MaxBackups,
+		}
+	}
+
+	return options
+}
+
 type configData struct {
-	Exchanges  map[string]map[string]string `yaml:"exchange"`
-	Currencies []string                     `yaml:"currency"`
-	Log        struct {
-		Enabled bool   `yaml:"enable"`
-		Path    string `yaml:"path"`
-	} `yaml:"log"`
+	Exchanges  map[string]*ExchangeConfig `yaml:"exchange"`
+	Currencies []string                   `yaml:"currency"`
+	Log        LogConfig                  `yaml:"log"`
+	Storage    *StorageConfig             `yaml:"storage,omitempty"`
+	Retention  *RetentionConfig           `yaml:"retention,omitempty"`
 }
 
 // Config is the main configuration struct for arbitrary services.
 type Config struct {
-	loaded bool
-	data   configData
+	loaded   bool
+	data     configData
+	document *yaml.Node
+	secrets  []string
+	// unknownFields are the problems of the unknown fields found by Load, they are reported by Validate.
+	unknownFields []Problem
 }
 
+// Load parses the config, the ${ENV_VAR} references are replaced with the environment variables and
+// the {secret_file: path} values are replaced with the contents of the files.
+// The unknown fields are reported with their line numbers as a *ValidationError, together with
+// the problems found by Validate so all of them can be fixed at once.
 func (c *Config) Load(dataBytes []byte) error {
-	if err := yaml.Unmarshal(dataBytes, &c.data); err != nil {
+	var document yaml.Node
+	if err := yaml.Unmarshal(dataBytes, &document); err != nil {
 		return err
 	}
 
+	c.secrets = nil
+	if err := c.resolveSecrets(&document, ""); err != nil {
+		return err
+	}
+
+	c.unknownFields = checkUnknownFields(&document, "", typeOfConfigData)
+
+	c.data = configData{}
+	if err := document.Decode(&c.data); err != nil {
+		return err
+	}
+
+	c.document = &document
 	c.loaded = true
+
+	if len(c.unknownFields) > 0 {
+		return c.Validate()
+	}
+
 	return nil
 }
 
-func (c *Config) GetExchangeSetting(exchangeName string) (map[string]string, error) {
+// GetExchangeConfig returns the config of the exchange, the currencies of the config are used
+// if the exchange does not override them.
+func (c *Config) GetExchangeConfig(exchangeName string) (*ExchangeConfig, error) {
 	if !c.loaded {
 		return nil, errors.New("config has not been loaded")
 	}
@@ -39,13 +153,34 @@ func (c *Config) GetExchangeSetting(exchangeName string) (map[string]string, err
 		return nil, errors.New("no exchanges found in config")
 	}
 
-	if exchangeSetting, ok := c.data.Exchanges[exchangeName]; ok {
-		return exchangeSetting, nil
+	if exchangeConfig, ok := c.data.Exchanges[exchangeName]; ok && exchangeConfig != nil {
+		result := *exchangeConfig
+		if len(result.Currencies) == 0 {
+			result.Currencies = c.data.Currencies
+		}
+
+		return &result, nil
 	} else {
 		return nil, errors.New("No exchange found with name " + exchangeName)
 	}
 }
 
+// GetExchangeNames returns the names of the configured exchanges in order.
+func (c *Config) GetExchangeNames() []string {
+	names := make([]string, 0, len(c.data.Exchanges))
+	if c.document == nil {
+		return names
+	}
+
+	if _, exchanges := lookupNode(c.document, "exchange"); exchanges != nil && exchanges.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(exchanges.Content); i += 2 {
+			names = append(names, exchanges.Content[i].Value)
+		}
+	}
+
+	return names
+}
+
 func (c *Config) GetCurrenciesSetting() ([]string, error) {
 	if !c.loaded {
 		return nil, errors.New("config has not been loaded")
@@ -57,3 +192,7 @@ func (c *Config) GetCurrenciesSetting() ([]string, error) {
 
 	return c.data.Currencies, nil
 }
+
+func (c *Config) GetLogSetting() LogConfig {
+	return c.data.Log
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"time"
+
+	"markets/pkg/database"
+)
+
+// defaultRetentionInterval is how often the retention policies are applied if the interval is not set.
+const defaultRetentionInterval = time.Hour
+
+type OrderRetentionConfig struct {
+	// MaxAge is how long the finished and canceled orders are kept after their last update, e.g. 168h.
+	MaxAge time.Duration `yaml:"maxAge"`
+	// ArchiveRegion and ArchivePath keep a copy of the pruned orders, they are dropped if neither is set.
+	ArchiveRegion string `yaml:"archiveRegion,omitempty"`
+	ArchivePath   string `yaml:"archivePath,omitempty"`
+}
+
+// RetentionConfig selects the retention policies applied to the storage in background.
+type RetentionConfig struct {
+	// Interval is how often the policies are applied, 1h by default.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Orders prunes the old terminal orders if it is set.
+	Orders *OrderRetentionConfig `yaml:"orders,omitempty"`
+	// DropZeroBalances drops the balances whose total is zero.
+	DropZeroBalances bool `yaml:"dropZeroBalances,omitempty"`
+	// PurgeOrderBooks purges the order books of the currencies which are not subscribed anymore.
+	PurgeOrderBooks bool `yaml:"purgeOrderBooks,omitempty"`
+}
+
+// GetInterval returns the interval of the policies, the default is used if it is not set.
+func (r *RetentionConfig) GetInterval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultRetentionInterval
+	}
+
+	return r.Interval
+}
+
+// Policies converts the config to the policies accepted by database.NewJanitor,
+// subscribed returns the subscribed currencies keyed by exchange name.
+func (r *RetentionConfig) Policies(subscribed func() map[string][]string) []database.RetentionPolicy {
+	var policies []database.RetentionPolicy
+
+	if r.Orders != nil {
+		policies = append(policies, &database.ArchiveOrdersPolicy{
+			MaxAge:        r.Orders.MaxAge,
+			ArchiveRegion: r.Orders.ArchiveRegion,
+			ArchivePath:   r.Orders.ArchivePath,
+		})
+	}
+
+	if r.DropZeroBalances {
+		policies = append(policies, &database.DropZeroBalancesPolicy{})
+	}
+
+	if r.PurgeOrderBooks {
+		policies = append(policies, &database.PurgeOrderBooksPolicy{Subscribed: subscribed})
+	}
+
+	return policies
+}
+
+// GetRetentionConfig returns the retention of the config, it is nil if nothing is pruned.
+func (c *Config) GetRetentionConfig() *RetentionConfig {
+	if c.data.Retention == nil {
+		return nil
+	}
+
+	result := *c.data.Retention
+	return &result
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"markets/pkg/database"
+	"markets/pkg/exchange"
+	"markets/pkg/logging"
+	"markets/pkg/wsclt"
+)
+
+// supportedExchanges are the exchanges which can be configured, and whether they require the password.
+var supportedExchanges = map[string]bool{
+	"okx":    true,
+	"gateio": false,
+}
+
+// supportedChannels are the channels which can be subscribed.
+var supportedChannels = map[string]bool{
+	exchange.ChannelOrderBook: true,
+	exchange.ChannelOrders:    true,
+	exchange.ChannelBalances:  true,
+}
+
+// supportedStorages are the storage types which can be configured, they match the storages of the database package.
+var supportedStorages = map[string]bool{
+	database.StorageMemory: true,
+	database.StorageRedis:  true,
+	database.StorageBolt:   true,
+	database.StorageSQL:    true,
+}
+
+var typeOfConfigData = reflect.TypeOf(configData{})
+
+// Problem is a mistake in the config, Line is 0 if the position is unknown.
+type Problem struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", p.Line, p.Path, p.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// ValidationError reports all problems of the config at once.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		messages = append(messages, problem.String())
+	}
+
+	return "invalid config:\n\t" + strings.Join(messages, "\n\t")
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// yamlFields maps the yaml names of the fields of the struct type to the field names.
+func yamlFields(structType reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		fields[name] = field
+	}
+
+	return fields
+}
+
+// checkUnknownFields walks the node along the type and reports the keys which are not fields of the structs.
+func checkUnknownFields(node *yaml.Node, path string, valueType reflect.Type) []Problem {
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+
+	var problems []Problem
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			problems = append(problems, checkUnknownFields(child, path, valueType)...)
+		}
+	case yaml.SequenceNode:
+		if valueType.Kind() == reflect.Slice {
+			for _, child := range node.Content {
+				problems = append(problems, checkUnknownFields(child, path, valueType.Elem())...)
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			switch valueType.Kind() {
+			case reflect.Map:
+				problems = append(problems, checkUnknownFields(value, joinPath(path, key.Value), valueType.Elem())...)
+			case reflect.Struct:
+				fields := yamlFields(valueType)
+				if field, ok := fields[key.Value]; ok {
+					problems = append(problems, checkUnknownFields(value, joinPath(path, key.Value), field.Type)...)
+					continue
+				}
+
+				message := fmt.Sprintf("unknown field %q", key.Value)
+				for name := range fields {
+					if strings.EqualFold(name, key.Value) {
+						message += fmt.Sprintf(", did you mean %q?", name)
+					}
+				}
+
+				problems = append(problems, Problem{Line: key.Line, Path: joinPath(path, key.Value), Message: message})
+			}
+		}
+	}
+
+	return problems
+}
+
+// lookupNode returns the key and the value of the path in the document, or nil if it is not found.
+// The key is the document itself if the path is empty.
+func lookupNode(document *yaml.Node, path ...string) (*yaml.Node, *yaml.Node) {
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+
+	key, node := document, document.Content[0]
+	for _, name := range path {
+		if node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+
+		key = nil
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				key, node = node.Content[i], node.Content[i+1]
+				break
+			}
+		}
+
+		if key == nil {
+			return nil, nil
+		}
+	}
+
+	return key, node
+}
+
+// problem reports the problem at the line of the path, or at the line of its closest parent if it is missing.
+func (c *Config) problem(message string, path ...string) Problem {
+	line := 0
+	for i := len(path); i >= 0 && c.document != nil; i-- {
+		if key, _ := lookupNode(c.document, path[:i]...); key != nil {
+			line = key.Line
+			break
+		}
+	}
+
+	return Problem{Line: line, Path: strings.Join(path, "."), Message: message}
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func validateApiURL(value string) bool {
+	apiURL, err := url.Parse(value)
+	return err == nil && apiURL.Scheme != "" && apiURL.Host != ""
+}
+
+// Validate checks the loaded config, all problems are reported at once as a *ValidationError,
+// including the unknown fields found by Load.
+func (c *Config) Validate() error {
+	if !c.loaded {
+		return &ValidationError{Problems: []Problem{{Message: "config has not been loaded"}}}
+	}
+
+	problems := append([]Problem(nil), c.unknownFields...)
+
+	if len(c.data.Exchanges) == 0 {
+		problems = append(problems, c.problem("at least one exchange is required", "exchange"))
+	}
+
+	if len(c.data.Currencies) == 0 {
+		problems = append(problems, c.problem("at least one currency is required", "currency"))
+	}
+
+	for _, name := range c.GetExchangeNames() {
+		exchangeConfig := c.data.Exchanges[name]
+
+		requiresPassword, ok := supportedExchanges[name]
+		if !ok {
+			problems = append(problems, c.problem("unsupported exchange", "exchange", name))
+			continue
+		}
+
+		if exchangeConfig == nil {
+			problems = append(problems, c.problem("the setting is empty", "exchange", name))
+			continue
+		}
+
+		required := map[string]string{"apiKey": exchangeConfig.ApiKey, "secret": exchangeConfig.Secret}
+		if requiresPassword {
+			required["password"] = exchangeConfig.Password
+		}
+
+		for _, key := range []string{"apiKey", "secret", "password"} {
+			if value, ok := required[key]; ok && value == "" {
+				problems = append(problems, c.problem("is required", "exchange", name, key))
+			}
+		}
+
+		// The proxy is checked as the connections parse it.
+		if proxy := exchangeConfig.Proxy; proxy != "" {
+			if _, err := wsclt.ParseProxyURL(proxy); err != nil {
+				problems = append(problems, c.problem("only http and socks5 proxies with a host are supported", "exchange", name, "proxy"))
+			}
+		}
+
+		if value := exchangeConfig.WebsocketApiUrl; value != "" && !validateApiURL(value) {
+			problems = append(problems, c.problem("the scheme and the host are required", "exchange", name, "websocketApiUrl"))
+		}
+
+		if value := exchangeConfig.RestApiUrl; value != "" && !validateApiURL(value) {
+			problems = append(problems, c.problem("the scheme and the host are required", "exchange", name, "restApiUrl"))
+		}
+
+		if exchangeConfig.PingInterval < 0 {
+			problems = append(problems, c.problem("must not be negative", "exchange", name, "pingInterval"))
+		}
+
+		if exchangeConfig.MaxSubscriptionsPerConnection < 0 {
+			problems = append(problems, c.problem("must not be negative", "exchange", name, "maxSubscriptionsPerConnection"))
+		}
+
+		for _, channel := range exchangeConfig.Channels {
+			if !supportedChannels[channel] {
+				problems = append(problems, c.problem(fmt.Sprintf("unsupported channel %q", channel), "exchange", name, "channels"))
+			}
+		}
+	}
+
+	if c.data.Log.Enabled && c.data.Log.Path == "" {
+		problems = append(problems, c.problem("the path is required when the log is enabled", "log", "path"))
+	}
+
+	if format := c.data.Log.Format; format != "" && format != logging.FormatText && format != logging.FormatJSON {
+		problems = append(problems, c.problem("only text and json are supported", "log", "format"))
+	}
+
+	if level := c.data.Log.Level; level != "" {
+		if _, err := logging.ParseLevel(level); err != nil {
+			problems = append(problems, c.problem("only debug, info, warn and error are supported", "log", "level"))
+		}
+	}
+
+	for _, component := range sortedKeys(c.data.Log.Levels) {
+		if _, err := logging.ParseLevel(c.data.Log.Levels[component]); err != nil {
+			problems = append(problems, c.problem("only debug, info, warn and error are supported", "log", "levels", component))
+		}
+	}
+
+	if c.data.Log.MaxSize < 0 {
+		problems = append(problems, c.problem("must not be negative", "log", "maxSize"))
+	}
+
+	if c.data.Log.RotateInterval < 0 {
+		problems = append(problems, c.problem("must not be negative", "log", "rotateInterval"))
+	}
+
+	if c.data.Log.MaxBackups < 0 {
+		problems = append(problems, c.problem("must not be negative", "log", "maxBackups"))
+	}
+
+	if storage := c.data.Storage; storage != nil {
+		switch {
+		case !supportedStorages[storage.Type]:
+			problems = append(problems, c.problem(fmt.Sprintf("unsupported storage %q", storage.Type), "storage", "type"))
+		case storage.Type == database.StorageRedis && storage.Redis.DB < 0:
+			problems = append(problems, c.problem("must not be negative", "storage", "redis", "db"))
+		case storage.Type == database.StorageBolt:
+			if storage.Bolt.Path == "" {
+				problems = append(problems, c.problem("is required", "storage", "bolt", "path"))
+			}
+
+			if _, ok := boltSyncPolicies[storage.Bolt.Sync]; !ok {
+				problems = append(problems, c.problem("only always, interval and never are supported", "storage", "bolt", "sync"))
+			}
+		case storage.Type == database.StorageSQL:
+			if storage.SQL.Driver == "" {
+				problems = append(problems, c.problem("is required", "storage", "sql", "driver"))
+			}
+
+			if storage.SQL.DSN == "" {
+				problems = append(problems, c.problem("is required", "storage", "sql", "dsn"))
+			}
+		}
+	}
+
+	if retention := c.data.Retention; retention != nil {
+		if retention.Interval < 0 {
+			problems = append(problems, c.problem("must not be negative", "retention", "interval"))
+		}
+
+		if retention.Orders != nil && retention.Orders.MaxAge <= 0 {
+			problems = append(problems, c.problem("must be positive", "retention", "orders", "maxAge"))
+		}
+
+		if retention.Orders == nil && !retention.DropZeroBalances && !retention.PurgeOrderBooks {
+			problems = append(problems, c.problem("at least one policy is required", "retention"))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"time"
+
+	"markets/pkg/database"
+)
+
+// boltSyncPolicies maps the sync setting of the bolt storage to the sync policies.
+var boltSyncPolicies = map[string]database.SyncPolicy{
+	"":         database.SyncAlways,
+	"always":   database.SyncAlways,
+	"interval": database.SyncInterval,
+	"never":    database.SyncNever,
+}
+
+type RedisStorageConfig struct {
+	// Addr is localhost:6379 by default.
+	Addr     string `yaml:"addr,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	DB       int    `yaml:"db,omitempty"`
+	TLS      bool   `yaml:"tls,omitempty"`
+	// TLSSkipVerify skips verifying the certificate of the server, e.g. a self-signed one.
+	TLSSkipVerify bool `yaml:"tlsSkipVerify,omitempty"`
+}
+
+type BoltStorageConfig struct {
+	Path string `yaml:"path,omitempty"`
+	// Sync is always, interval or never, always by default.
+	Sync         string        `yaml:"sync,omitempty"`
+	SyncInterval time.Duration `yaml:"syncInterval,omitempty"`
+}
+
+type SQLStorageConfig struct {
+	// Driver is the name of the registered database/sql driver, e.g. sqlite.
+	Driver string `yaml:"driver,omitempty"`
+	DSN    string `yaml:"dsn,omitempty"`
+}
+
+// StorageConfig selects the database shared by all exchanges.
+type StorageConfig struct {
+	// Type is memory, redis, bolt or sql.
+	Type  string             `yaml:"type"`
+	Redis RedisStorageConfig `yaml:"redis,omitempty"`
+	Bolt  BoltStorageConfig  `yaml:"bolt,omitempty"`
+	SQL   SQLStorageConfig   `yaml:"sql,omitempty"`
+}
+
+// Options converts the config to the options accepted by database.NewConnector.
+func (s *StorageConfig) Options() *database.StorageOptions {
+	return &database.StorageOptions{
+		Type: s.Type,
+		Redis: database.RedisStorageOptions{
+			Addr:          s.Redis.Addr,
+			Username:      s.Redis.Username,
+			Password:      s.Redis.Password,
+			DB:            s.Redis.DB,
+			TLS:           s.Redis.TLS,
+			TLSSkipVerify: s.Redis.TLSSkipVerify,
+		},
+		Bolt: database.BoltStorageOptions{
+			Path: s.Bolt.Path,
+			Options: database.BoltOptions{
+				SyncPolicy:   boltSyncPolicies[s.Bolt.Sync],
+				SyncInterval: s.Bolt.SyncInterval,
+			},
+		},
+		SQL: database.SQLStorageOptions{
+			Driver: s.SQL.Driver,
+			DSN:    s.SQL.DSN,
+		},
+	}
+}
+
+// GetStorageConfig returns the storage of the config, the redis on localhost:6379 is used if it is not configured.
+func (c *Config) GetStorageConfig() *StorageConfig {
+	if c.data.Storage == nil {
+		return &StorageConfig{Type: database.StorageRedis}
+	}
+
+	result := *c.data.Storage
+	return &result
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// LoadFile reads the config file, loads and validates it.
+func LoadFile(path string) (*Config, error) {
+	dataBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := cfg.Load(dataBytes); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// WatcherOptions configures how the config file is watched.
+type WatcherOptions struct {
+	// Interval is the interval of checking the modification of the file, 5 seconds by default.
+	Interval time.Duration
+	// OnReload is called with the new config after the file has been loaded and validated.
+	OnReload func(cfg *Config)
+	// OnError is called if the file can't be loaded, the previous config stays in effect.
+	OnError func(err error)
+}
+
+// Watcher reloads the config file when it is modified or the process receives SIGHUP.
+type Watcher struct {
+	path    string
+	options *WatcherOptions
+
+	mux     sync.Mutex
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (w *Watcher) interval() time.Duration {
+	if w.options.Interval > 0 {
+		return w.options.Interval
+	}
+
+	return 5 * time.Second
+}
+
+// changed reports whether the file has been modified since the last check.
+func (w *Watcher) changed() (bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, err
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false, nil
+	}
+
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	return true, nil
+}
+
+// Reload loads the config file and hands it to OnReload, the errors are reported to OnError.
+func (w *Watcher) Reload() {
+	if cfg, err := LoadFile(w.path); err != nil {
+		if w.options.OnError != nil {
+			w.options.OnError(err)
+		}
+	} else if w.options.OnReload != nil {
+		w.options.OnReload(cfg)
+	}
+}
+
+func (w *Watcher) watch() {
+	defer close(w.done)
+
+	hangupSignal := make(chan os.Signal, 1)
+	signal.Notify(hangupSignal, syscall.SIGHUP)
+	defer signal.Stop(hangupSignal)
+
+	ticker := time.NewTicker(w.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-hangupSignal:
+			_, _ = w.changed()
+			w.Reload()
+		case <-ticker.C:
+			if changed, err := w.changed(); err != nil {
+				if w.options.OnError != nil {
+					w.options.OnError(err)
+				}
+			} else if changed {
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Start watches the file in the background, the current version of the file is not reloaded.
+func (w *Watcher) Start() error {
+	if _, err := w.changed(); err != nil {
+		return err
+	}
+
+	go w.watch()
+	return nil
+}
+
+// Stop stops watching and waits for the pending reload to finish.
+func (w *Watcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func NewWatcher(path string, options *WatcherOptions) *Watcher {
+	return &Watcher{
+		path:    path,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
@@ -0,0 +1,343 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// SyncPolicy decides when the bolt connector flushes the written data to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways calls fsync after every committed write, it is the safest but the slowest policy.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval calls fsync periodically, the data written after the last sync may be lost on power failure.
+	SyncInterval
+	// SyncNever leaves the flushing to the operating system.
+	SyncNever
+)
+
+type BoltOptions struct {
+	SyncPolicy   SyncPolicy
+	SyncInterval time.Duration
+	FileMode     os.FileMode
+	Timeout      time.Duration
+	// Logger receives the errors of the periodic syncs, slog.Default() is used if it is nil.
+	Logger *slog.Logger
+}
+
+// renameFile replaces the database file by the compacted one, it is replaced in tests to simulate a failure.
+var renameFile = os.Rename
+
+// BoltConnector is a connector that stores the values in an embedded key-value file,
+// every region is stored as a bucket.
+type BoltConnector struct {
+	db      *bolt.DB
+	path    string
+	options BoltOptions
+
+	mux      sync.RWMutex
+	stopSync chan bool
+	syncDone chan bool
+}
+
+func (c *BoltConnector) Set(region string, key string, valuePointer *string) error {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if c.db == nil {
+		return errors.New("database is closed")
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(region))
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(key), []byte(*valuePointer))
+	})
+}
+
+func (c *BoltConnector) Get(region string, key string) (*string, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if c.db == nil {
+		return nil, errors.New("database is closed")
+	}
+
+	var value string
+
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(region))
+		if bucket == nil {
+			return errors.New("region not found")
+		}
+
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return errors.New("key not found")
+		}
+
+		// The returned slice is only valid during the transaction.
+		value = string(data)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
+
+func (c *BoltConnector) Delete(region string, key string) error {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if c.db == nil {
+		return errors.New("database is closed")
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(region))
+		if bucket == nil {
+			return errors.New("region not found")
+		}
+
+		if bucket.Get([]byte(key)) == nil {
+			return errors.New("key not found")
+		}
+
+		return bucket.Delete([]byte(key))
+	})
+}
+
+func (c *BoltConnector) Keys(region string, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+
+	if err := c.Scan(region, prefix, func(key string, _ *string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Scan iterates the region in a read transaction, the handler must not write to the connector.
+func (c *BoltConnector) Scan(region string, prefix string, handler func(key string, value *string) error) error {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if c.db == nil {
+		return errors.New("database is closed")
+	}
+
+	return c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(region))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		prefixBytes := []byte(prefix)
+
+		// The keys in a bucket are sorted, so the matched keys are continuous.
+		for key, data := cursor.Seek(prefixBytes); key != nil && bytes.HasPrefix(key, prefixBytes); key, data = cursor.Next() {
+			value := string(data)
+			if err := handler(string(key), &value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Sync flushes the written data to disk manually.
+func (c *BoltConnector) Sync() error {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if c.db == nil {
+		return errors.New("database is closed")
+	}
+
+	return c.db.Sync()
+}
+
+// Compact rewrites the database file to reclaim the space of the deleted records.
+// All reads and writes are blocked until the compaction is finished.
+func (c *BoltConnector) Compact() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.db == nil {
+		return errors.New("database is closed")
+	}
+
+	compactPath := c.path + ".compact"
+	_ = os.Remove(compactPath)
+
+	dst, err := bolt.Open(compactPath, c.options.FileMode, &bolt.Options{
+		Timeout: c.options.Timeout,
+		NoSync:  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := bolt.Compact(dst, c.db, 0); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(compactPath)
+		return err
+	}
+
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(compactPath)
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(compactPath)
+		return err
+	}
+
+	if err := c.db.Close(); err != nil {
+		return err
+	}
+
+	c.db = nil
+
+	// Rename is atomic, the original file is still intact if the process crashes before this line.
+	if err := renameFile(compactPath, c.path); err != nil {
+		_ = os.Remove(compactPath)
+		// The original file is intact, so it is opened again and the connector keeps working.
+		if openErr := c.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+
+	return c.open()
+}
+
+// Ping checks that the database is open and readable.
+func (c *BoltConnector) Ping() error {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if c.db == nil {
+		return errors.New("database is closed")
+	}
+
+	return c.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+func (c *BoltConnector) Close() error {
+	if c.stopSync != nil {
+		close(c.stopSync)
+		<-c.syncDone
+		c.stopSync = nil
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.db == nil {
+		return nil
+	}
+
+	err := c.db.Close()
+	c.db = nil
+	return err
+}
+
+func (c *BoltConnector) open() error {
+	db, err := bolt.Open(c.path, c.options.FileMode, &bolt.Options{
+		Timeout: c.options.Timeout,
+		NoSync:  c.options.SyncPolicy != SyncAlways,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.db = db
+	return nil
+}
+
+func (c *BoltConnector) syncPeriodically() {
+	defer close(c.syncDone)
+
+	ticker := time.NewTicker(c.options.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopSync:
+			if err := c.Sync(); err != nil {
+				c.options.Logger.Error("can't sync the bolt database", "path", c.path, "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := c.Sync(); err != nil {
+				c.options.Logger.Error("can't sync the bolt database", "path", c.path, "error", err)
+			}
+		}
+	}
+}
+
+func NewBoltConnector(path string, options *BoltOptions) (*BoltConnector, error) {
+	c := &BoltConnector{
+		path: path,
+		options: BoltOptions{
+			SyncPolicy:   SyncAlways,
+			SyncInterval: time.Second,
+			FileMode:     0600,
+			Timeout:      time.Second,
+			Logger:       slog.Default(),
+		},
+	}
+
+	if options != nil {
+		c.options.SyncPolicy = options.SyncPolicy
+
+		if options.SyncInterval > 0 {
+			c.options.SyncInterval = options.SyncInterval
+		}
+
+		if options.FileMode != 0 {
+			c.options.FileMode = options.FileMode
+		}
+
+		if options.Timeout > 0 {
+			c.options.Timeout = options.Timeout
+		}
+
+		if options.Logger != nil {
+			c.options.Logger = options.Logger
+		}
+	}
+
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+
+	if c.options.SyncPolicy == SyncInterval {
+		c.stopSync = make(chan bool)
+		c.syncDone = make(chan bool)
+		go c.syncPeriodically()
+	}
+
+	return c, nil
+}
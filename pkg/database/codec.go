@@ -0,0 +1,99 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// CodecVersionJSON is the version of the JSON codec, JSON values are stored without the version byte
+	// so the data written before codecs were introduced can still be read.
+	CodecVersionJSON byte = 0
+	// CodecVersionMsgPack is the version byte prepended to the MessagePack encoded values.
+	CodecVersionMsgPack byte = 1
+)
+
+// Codec is the interface that serializes the values stored by Interactor.
+type Codec interface {
+	Version() byte
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte, value interface{}) error
+}
+
+// JSONCodec is the default codec, it is readable but slow.
+type JSONCodec struct{}
+
+func (_ JSONCodec) Version() byte {
+	return CodecVersionJSON
+}
+
+func (_ JSONCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (_ JSONCodec) Unmarshal(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// MsgPackCodec is a compact binary codec based on MessagePack.
+// The field names follow the json tags of the structures in format.go.
+type MsgPackCodec struct{}
+
+func (_ MsgPackCodec) Version() byte {
+	return CodecVersionMsgPack
+}
+
+func (_ MsgPackCodec) Marshal(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (_ MsgPackCodec) Unmarshal(data []byte, value interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+
+	return decoder.Decode(value)
+}
+
+// knownCodecs are the codecs which can be recognized by the version byte while decoding.
+var knownCodecs = map[byte]Codec{
+	CodecVersionMsgPack: MsgPackCodec{},
+}
+
+func encodeWithCodec(codec Codec, value interface{}) (string, error) {
+	dataBytes, err := codec.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	if codec.Version() == CodecVersionJSON {
+		return string(dataBytes), nil
+	}
+
+	return string(append([]byte{codec.Version()}, dataBytes...)), nil
+}
+
+// decodeWithCodec decodes the value written by any known codec, so the values written before
+// and after switching the codec can be mixed during migration.
+func decodeWithCodec(data string, value interface{}) error {
+	if len(data) == 0 {
+		return errors.New("empty value")
+	}
+
+	if codec, ok := knownCodecs[data[0]]; ok {
+		return codec.Unmarshal([]byte(data[1:]), value)
+	}
+
+	return JSONCodec{}.Unmarshal([]byte(data), value)
+}
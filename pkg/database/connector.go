@@ -3,6 +3,9 @@ package database
 import (
 	"context"
 	"errors"
+	"sort"
+	"strings"
+	"sync"
 
 	redis "github.com/go-redis/redis/v8"
 )
@@ -12,14 +15,23 @@ type Connector interface {
 	Get(region string, name string) (*string, error)
 	Set(region string, name string, value *string) error
 	Delete(region string, name string) error
+	// Keys returns the keys in the region starting with the prefix, an empty prefix matches every key.
+	Keys(region string, prefix string) ([]string, error)
+	// Scan calls the handler with every key-value pair in the region starting with the prefix,
+	// the iteration stops at the first error returned by the handler.
+	Scan(region string, prefix string, handler func(key string, value *string) error) error
 }
 
-// InternalConnector is a connector that stores the values in memory.
+// InternalConnector is a connector that stores the values in memory, it is safe for concurrent use.
 type InternalConnector struct {
+	mux     sync.RWMutex
 	storage map[string]map[string]string
 }
 
 func (c *InternalConnector) Set(region string, key string, valuePointer *string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
 	if c.storage[region] == nil {
 		c.storage[region] = make(map[string]string)
 	}
@@ -29,6 +41,9 @@ func (c *InternalConnector) Set(region string, key string, valuePointer *string)
 }
 
 func (c *InternalConnector) Get(region string, key string) (*string, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
 	if c.storage[region] == nil {
 		return nil, errors.New("region not found")
 	}
@@ -41,6 +56,9 @@ func (c *InternalConnector) Get(region string, key string) (*string, error) {
 }
 
 func (c *InternalConnector) Delete(region string, key string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
 	if c.storage[region] == nil {
 		return errors.New("region not found")
 	}
@@ -53,6 +71,46 @@ func (c *InternalConnector) Delete(region string, key string) error {
 	return errors.New("key not found")
 }
 
+func (c *InternalConnector) Keys(region string, prefix string) ([]string, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	keys := make([]string, 0)
+
+	for key := range c.storage[region] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (c *InternalConnector) Scan(region string, prefix string, handler func(key string, value *string) error) error {
+	keys, err := c.Keys(region, prefix)
+	if err != nil {
+		return err
+	}
+
+	// The lock is not held while calling the handler, so it may modify the region.
+	for _, key := range keys {
+		c.mux.RLock()
+		value, ok := c.storage[region][key]
+		c.mux.RUnlock()
+
+		if !ok {
+			continue
+		}
+
+		if err := handler(key, &value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func NewInternalConnector() *InternalConnector {
 	return &InternalConnector{
 		storage: make(map[string]map[string]string),
@@ -81,6 +139,58 @@ func (c *RedisConnector) Delete(region string, key string) error {
 	return c.client.HDel(c.context, region, key).Err()
 }
 
+// escapeRedisPattern escapes the special characters of the glob-style pattern used by HSCAN MATCH.
+func escapeRedisPattern(prefix string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+	return replacer.Replace(prefix)
+}
+
+func (c *RedisConnector) Keys(region string, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+
+	if err := c.Scan(region, prefix, func(key string, _ *string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (c *RedisConnector) Scan(region string, prefix string, handler func(key string, value *string) error) error {
+	var cursor uint64
+
+	for {
+		// HSCAN returns the keys and the values alternately.
+		pairs, nextCursor, err := c.client.HScan(c.context, region, cursor, escapeRedisPattern(prefix)+"*", 100).Result()
+		if err != nil {
+			return err
+		}
+
+		for index := 0; index+1 < len(pairs); index += 2 {
+			if err := handler(pairs[index], &pairs[index+1]); err != nil {
+				return err
+			}
+		}
+
+		if nextCursor == 0 {
+			return nil
+		}
+
+		cursor = nextCursor
+	}
+}
+
+// Ping checks the connection to redis.
+func (c *RedisConnector) Ping() error {
+	return c.client.Ping(c.context).Err()
+}
+
+func (c *RedisConnector) Close() error {
+	return c.client.Close()
+}
+
 func NewRedisConnector(options *redis.Options) *RedisConnector {
 	return &RedisConnector{
 		client:  redis.NewClient(options),
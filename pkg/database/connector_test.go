@@ -1,9 +1,17 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	redis "github.com/go-redis/redis/v8"
+	_ "modernc.org/sqlite"
 )
 
 func TestConnector_Internal(t *testing.T) {
@@ -27,6 +35,13 @@ func TestConnector_Internal(t *testing.T) {
 }
 
 func TestConnector_Redis_(t *testing.T) {
+	// The test needs a redis on localhost, it is skipped offline.
+	if conn, err := net.DialTimeout("tcp", "localhost:6379", time.Second); err != nil {
+		t.Skip("redis is not reachable:", err)
+	} else {
+		_ = conn.Close()
+	}
+
 	c := NewRedisConnector(&redis.Options{
 		Addr:     "localhost:6379",
 		Password: "", // no password set
@@ -49,3 +64,195 @@ func TestConnector_Redis_(t *testing.T) {
 		t.Errorf("RedisConnector Delete Error: %v", err)
 	}
 }
+
+func TestConnector_Bolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "markets.db")
+
+	c, err := NewBoltConnector(path, &BoltOptions{SyncPolicy: SyncInterval})
+	if err != nil {
+		t.Fatalf("BoltConnector Open Error: %v", err)
+	}
+
+	testString := "testing1234567890"
+
+	if err := c.Set("TEST", "TEST_KEY", &testString); err != nil {
+		t.Errorf("BoltConnector Set Error: %v", err)
+	}
+
+	if err := c.Set("TEST", "TEST_KEY_2", &testString); err != nil {
+		t.Errorf("BoltConnector Set Error: %v", err)
+	}
+
+	if err := c.Delete("TEST", "TEST_KEY_2"); err != nil {
+		t.Errorf("BoltConnector Delete Error: %v", err)
+	}
+
+	if err := c.Compact(); err != nil {
+		t.Errorf("BoltConnector Compact Error: %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("BoltConnector Close Error: %v", err)
+	}
+
+	// The value should survive the restart.
+	c, err = NewBoltConnector(path, nil)
+	if err != nil {
+		t.Fatalf("BoltConnector Reopen Error: %v", err)
+	}
+
+	if dataStringPointer, err := c.Get("TEST", "TEST_KEY"); err != nil {
+		t.Errorf("BoltConnector Get Error: %v", err)
+	} else if *dataStringPointer != testString {
+		t.Errorf("BoltConnector Get Error: The value from database is not as same as the one set before.")
+	}
+
+	if _, err := c.Get("TEST", "TEST_KEY_2"); err == nil {
+		t.Errorf("BoltConnector Get Error: The deleted value is still in the database.")
+	}
+
+	if keys, err := c.Keys("TEST", "TEST_"); err != nil {
+		t.Errorf("BoltConnector Keys Error: %v", err)
+	} else if len(keys) != 1 || keys[0] != "TEST_KEY" {
+		t.Errorf("BoltConnector Keys Error: Unexpected keys '%v'", keys)
+	}
+
+	if err := c.Delete("TEST", "TEST_KEY"); err != nil {
+		t.Errorf("BoltConnector Delete Error: %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("BoltConnector Close Error: %v", err)
+	}
+}
+
+func TestConnector_Bolt_CompactRenameError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "markets.db")
+
+	c, err := NewBoltConnector(path, nil)
+	if err != nil {
+		t.Fatalf("BoltConnector Open Error: %v", err)
+	}
+	defer c.Close()
+
+	testString := "testing1234567890"
+	if err := c.Set("TEST", "TEST_KEY", &testString); err != nil {
+		t.Errorf("BoltConnector Set Error: %v", err)
+	}
+
+	renameFile = func(string, string) error {
+		return errors.New("rename failed")
+	}
+	defer func() { renameFile = os.Rename }()
+
+	if err := c.Compact(); err == nil || err.Error() != "rename failed" {
+		t.Errorf("BoltConnector Compact Error: expected the rename to fail, got %v", err)
+	}
+
+	// The original file is opened again, so the connector keeps working.
+	if dataStringPointer, err := c.Get("TEST", "TEST_KEY"); err != nil {
+		t.Errorf("BoltConnector Get Error: %v", err)
+	} else if *dataStringPointer != testString {
+		t.Errorf("BoltConnector Get Error: The value from database is not as same as the one set before.")
+	}
+
+	if err := c.Set("TEST", "TEST_KEY_2", &testString); err != nil {
+		t.Errorf("BoltConnector Set Error: %v", err)
+	}
+
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("BoltConnector Compact Error: the compacted file is left behind: %v", err)
+	}
+}
+
+func TestConnector_SQL(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "markets.sqlite")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("SQLConnector Open Error: %v", err)
+	}
+
+	c, err := NewSQLConnector(db)
+	if err != nil {
+		t.Fatalf("SQLConnector Migrate Error: %v", err)
+	}
+	defer c.Close()
+
+	// Migrating twice should be a no-op.
+	if _, err := NewSQLConnector(db); err != nil {
+		t.Errorf("SQLConnector Migrate Error: %v", err)
+	}
+
+	testString := "testing1234567890"
+
+	if err := c.Set("TEST", "TEST_KEY", &testString); err != nil {
+		t.Errorf("SQLConnector Set Error: %v", err)
+	}
+
+	if dataStringPointer, err := c.Get("TEST", "TEST_KEY"); err != nil {
+		t.Errorf("SQLConnector Get Error: %v", err)
+	} else if *dataStringPointer != testString {
+		t.Errorf("SQLConnector Get Error: The value from database is not as same as the one set before.")
+	}
+
+	if err := c.Delete("TEST", "TEST_KEY"); err != nil {
+		t.Errorf("SQLConnector Delete Error: %v", err)
+	}
+
+	if err := c.Delete("TEST", "TEST_KEY"); err == nil {
+		t.Errorf("SQLConnector Delete Error: Deleting a missing key should fail.")
+	}
+
+	interactor := NewInteractor(c)
+
+	testOrderBook := OrderBook{
+		Asks: map[string]string{"0.0000026400": "1000000"},
+		Bids: map[string]string{"0.0000026200": "1000000", "0.0000026000": "20000"},
+	}
+
+	if err := interactor.SetOrderBook("TestExchange", "TEST/USDT", &testOrderBook); err != nil {
+		t.Errorf("SQLConnector SetOrderBook Error: %v", err)
+	}
+
+	if dataPointer, err := interactor.GetOrderBook("TestExchange", "TEST/USDT"); err != nil {
+		t.Errorf("SQLConnector GetOrderBook Error: %v", err)
+	} else if !reflect.DeepEqual(*dataPointer, testOrderBook) {
+		t.Errorf("SQLConnector GetOrderBook Error: Expected '%v', got '%v'", testOrderBook, *dataPointer)
+	}
+
+	testOrder := Order{Id: "123456789", Type: "limit", Side: "buy", Price: 0.00000264, Amount: 1000000, Status: "created"}
+
+	if err := interactor.SetOrder("TestExchange", "TEST/USDT", testOrder.Id, &testOrder); err != nil {
+		t.Errorf("SQLConnector SetOrder Error: %v", err)
+	}
+
+	if dataPointer, err := interactor.GetOrder("TestExchange", "TEST/USDT", testOrder.Id); err != nil {
+		t.Errorf("SQLConnector GetOrder Error: %v", err)
+	} else if !reflect.DeepEqual(*dataPointer, testOrder) {
+		t.Errorf("SQLConnector GetOrder Error: Expected '%v', got '%v'", testOrder, *dataPointer)
+	}
+
+	if err := interactor.SetBalance("TestExchange", "TEST", &Balance{Free: 1, Used: 2, Total: 3}); err != nil {
+		t.Errorf("SQLConnector SetBalance Error: %v", err)
+	}
+
+	// The typed values should be queryable with SQL.
+	var total float64
+	if err := c.DB().QueryRow(`SELECT total FROM balances WHERE exchange = ? AND currency = ?`,
+		"TestExchange", "TEST").Scan(&total); err != nil {
+		t.Errorf("SQLConnector Query Error: %v", err)
+	} else if total != 3 {
+		t.Errorf("SQLConnector Query Error: Expected total to be 3, got %v", total)
+	}
+
+	if keys, err := c.Keys("Order", "TestExchange.TEST/USDT."); err != nil {
+		t.Errorf("SQLConnector Keys Error: %v", err)
+	} else if !reflect.DeepEqual(keys, []string{"TestExchange.TEST/USDT.123456789"}) {
+		t.Errorf("SQLConnector Keys Error: Unexpected keys '%v'", keys)
+	}
+
+	if orderBooks, err := interactor.ListOrderBooks("TestExchange", ""); err != nil {
+		t.Errorf("SQLConnector ListOrderBooks Error: %v", err)
+	} else if !reflect.DeepEqual(*orderBooks["TEST/USDT"], testOrderBook) {
+		t.Errorf("SQLConnector ListOrderBooks Error: Expected '%v', got '%v'", testOrderBook, orderBooks)
+	}
+}
@@ -1,42 +1,86 @@
 package database
 
 import (
-	"encoding/json"
 	"math"
 	"strings"
+	"time"
 )
 
 // Interactor is the interface for interacting with the database
 type Interactor struct {
 	connector Connector
+	codec     Codec
+	metrics   *Metrics
+}
+
+// InteractorOption customizes the Interactor created by NewInteractor.
+type InteractorOption func(*Interactor)
+
+// WithCodec sets the codec used to serialize the values, JSONCodec is used by default.
+// Values written by the other known codecs are still readable.
+func WithCodec(codec Codec) InteractorOption {
+	return func(i *Interactor) {
+		i.codec = codec
+	}
 }
 
 func (_ *Interactor) GenerateKeyWithPath(path []string) string {
 	return strings.Join(path, ".")
 }
 
-func (i *Interactor) GetString(region string, key string) (*string, error) {
+func (i *Interactor) get(region string, key string, value interface{}) error {
 	dataStringPointer, err := i.connector.Get(region, key)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return dataStringPointer, nil
+	return decodeWithCodec(*dataStringPointer, value)
 }
 
-func (i *Interactor) SetString(region string, key string, value *string) error {
-	return i.connector.Set(region, key, value)
+func (i *Interactor) set(region string, key string, value interface{}) error {
+	dataString, err := encodeWithCodec(i.codec, value)
+	if err != nil {
+		return err
+	}
+
+	return i.write(region, key, &dataString)
 }
 
-func (i *Interactor) GetMap(region string, key string) (*map[string]interface{}, error) {
+// write stores the encoded value, the writes are measured if the metrics are enabled.
+func (i *Interactor) write(region string, key string, value *string) error {
+	start := time.Now()
+	err := i.connector.Set(region, key, value)
+	i.metrics.observeWrite(region, start, err)
+
+	return err
+}
+
+// remove deletes the key, the deletions are measured as writes.
+func (i *Interactor) remove(region string, key string) error {
+	start := time.Now()
+	err := i.connector.Delete(region, key)
+	i.metrics.observeWrite(region, start, err)
+
+	return err
+}
+
+func (i *Interactor) GetString(region string, key string) (*string, error) {
 	dataStringPointer, err := i.connector.Get(region, key)
 	if err != nil {
 		return nil, err
 	}
 
+	return dataStringPointer, nil
+}
+
+func (i *Interactor) SetString(region string, key string, value *string) error {
+	return i.write(region, key, value)
+}
+
+func (i *Interactor) GetMap(region string, key string) (*map[string]interface{}, error) {
 	var data map[string]interface{}
 
-	if err := json.Unmarshal([]byte(*dataStringPointer), &data); err != nil {
+	if err := i.get(region, key, &data); err != nil {
 		return nil, err
 	}
 
@@ -44,29 +88,19 @@ func (i *Interactor) GetMap(region string, key string) (*map[string]interface{},
 }
 
 func (i *Interactor) SetMap(region string, key string, value *map[string]interface{}) error {
-	if dataBytes, err := json.Marshal(value); err != nil {
-		return err
-	} else {
-		dataString := string(dataBytes)
-		return i.connector.Set(region, key, &dataString)
-	}
+	return i.set(region, key, value)
 }
 
 func (i *Interactor) Delete(region string, key string) error {
-	return i.connector.Delete(region, key)
+	return i.remove(region, key)
 }
 
 func (i *Interactor) GetBalance(exchangeName string, currency string) (*Balance, error) {
 	key := i.GenerateKeyWithPath([]string{exchangeName, currency})
 
-	dataString, err := i.connector.Get("Balance", key)
-	if err != nil {
-		return nil, err
-	}
-
 	var data Balance
 
-	if err := json.Unmarshal([]byte(*dataString), &data); err != nil {
+	if err := i.get("Balance", key, &data); err != nil {
 		return nil, err
 	}
 
@@ -75,25 +109,15 @@ func (i *Interactor) GetBalance(exchangeName string, currency string) (*Balance,
 
 func (i *Interactor) SetBalance(exchangeName string, currency string, balance *Balance) error {
 	key := i.GenerateKeyWithPath([]string{exchangeName, currency})
-	if dataBytes, err := json.Marshal(balance); err != nil {
-		return err
-	} else {
-		dataString := string(dataBytes)
-		return i.connector.Set("Balance", key, &dataString)
-	}
+	return i.set("Balance", key, balance)
 }
 
 func (i *Interactor) GetFee(exchangeName string, currency string) (*Fee, error) {
 	key := i.GenerateKeyWithPath([]string{exchangeName, currency})
 
-	dataStringPointer, err := i.connector.Get("Fee", key)
-	if err != nil {
-		return nil, err
-	}
-
 	var data Fee
 
-	if err := json.Unmarshal([]byte(*dataStringPointer), &data); err != nil {
+	if err := i.get("Fee", key, &data); err != nil {
 		return nil, err
 	}
 
@@ -106,25 +130,15 @@ func (i *Interactor) SetFee(exchangeName string, currency string, fee *Fee) erro
 	fee.Taker = math.Abs(fee.Taker)
 	fee.Maker = math.Abs(fee.Maker)
 
-	if dataBytes, err := json.Marshal(fee); err != nil {
-		return err
-	} else {
-		dataString := string(dataBytes)
-		return i.connector.Set("Fee", key, &dataString)
-	}
+	return i.set("Fee", key, fee)
 }
 
 func (i *Interactor) GetOrder(exchangeName string, currency string, orderId string) (*Order, error) {
 	key := i.GenerateKeyWithPath([]string{exchangeName, currency, orderId})
 
-	dataStringPointer, err := i.connector.Get("Order", key)
-	if err != nil {
-		return nil, err
-	}
-
 	var data Order
 
-	if err := json.Unmarshal([]byte(*dataStringPointer), &data); err != nil {
+	if err := i.get("Order", key, &data); err != nil {
 		return nil, err
 	}
 
@@ -133,25 +147,15 @@ func (i *Interactor) GetOrder(exchangeName string, currency string, orderId stri
 
 func (i *Interactor) SetOrder(exchangeName string, currency string, orderId string, order *Order) error {
 	key := i.GenerateKeyWithPath([]string{exchangeName, currency, orderId})
-	if dataBytes, err := json.Marshal(order); err != nil {
-		return err
-	} else {
-		dataString := string(dataBytes)
-		return i.connector.Set("Order", key, &dataString)
-	}
+	return i.set("Order", key, order)
 }
 
 func (i *Interactor) GetOrderBook(exchangeName string, currency string) (*OrderBook, error) {
 	key := i.GenerateKeyWithPath([]string{exchangeName, currency})
 
-	dataStringPointer, err := i.connector.Get("OrderBook", key)
-	if err != nil {
-		return nil, err
-	}
-
 	var data OrderBook
 
-	if err := json.Unmarshal([]byte(*dataStringPointer), &data); err != nil {
+	if err := i.get("OrderBook", key, &data); err != nil {
 		return nil, err
 	}
 
@@ -160,16 +164,134 @@ func (i *Interactor) GetOrderBook(exchangeName string, currency string) (*OrderB
 
 func (i *Interactor) SetOrderBook(exchangeName string, currency string, orderBook *OrderBook) error {
 	key := i.GenerateKeyWithPath([]string{exchangeName, currency})
-	if dataBytes, err := json.Marshal(orderBook); err != nil {
+	return i.set("OrderBook", key, orderBook)
+}
+
+// DeleteOrderBook deletes the stored order book, it is not an error if the order book has never been stored.
+func (i *Interactor) DeleteOrderBook(exchangeName string, currency string) error {
+	key := i.GenerateKeyWithPath([]string{exchangeName, currency})
+
+	keys, err := i.connector.Keys("OrderBook", key)
+	if err != nil {
 		return err
-	} else {
-		dataString := string(dataBytes)
-		return i.connector.Set("OrderBook", key, &dataString)
 	}
+
+	for _, value := range keys {
+		if value == key {
+			return i.remove("OrderBook", key)
+		}
+	}
+
+	return nil
+}
+
+// scan decodes every value in the region whose key starts with the path,
+// newValue returns the pointer the value is decoded into, the value is skipped if it returns nil.
+func (i *Interactor) scan(region string, path []string, newValue func(subPath []string) interface{}) error {
+	prefix := i.GenerateKeyWithPath(path) + "."
+
+	return i.connector.Scan(region, prefix, func(key string, value *string) error {
+		subPath := strings.Split(strings.TrimPrefix(key, prefix), ".")
+		if pointer := newValue(subPath); pointer != nil {
+			return decodeWithCodec(*value, pointer)
+		}
+
+		return nil
+	})
+}
+
+// ListBalances returns the balances of the exchange, keyed by currency.
+// The balances of every currency are returned if the currency is empty.
+func (i *Interactor) ListBalances(exchangeName string, currency string) (map[string]*Balance, error) {
+	balances := make(map[string]*Balance)
+
+	if err := i.scan("Balance", []string{exchangeName}, func(subPath []string) interface{} {
+		if currency != "" && subPath[0] != currency {
+			return nil
+		}
+
+		balances[subPath[0]] = &Balance{}
+		return balances[subPath[0]]
+	}); err != nil {
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+// ListFees returns the fees of the exchange, keyed by currency.
+// The fees of every currency are returned if the currency is empty.
+func (i *Interactor) ListFees(exchangeName string, currency string) (map[string]*Fee, error) {
+	fees := make(map[string]*Fee)
+
+	if err := i.scan("Fee", []string{exchangeName}, func(subPath []string) interface{} {
+		if currency != "" && subPath[0] != currency {
+			return nil
+		}
+
+		fees[subPath[0]] = &Fee{}
+		return fees[subPath[0]]
+	}); err != nil {
+		return nil, err
+	}
+
+	return fees, nil
+}
+
+// ListOrderBooks returns the order books of the exchange, keyed by currency.
+// The order books of every currency are returned if the currency is empty.
+func (i *Interactor) ListOrderBooks(exchangeName string, currency string) (map[string]*OrderBook, error) {
+	orderBooks := make(map[string]*OrderBook)
+
+	if err := i.scan("OrderBook", []string{exchangeName}, func(subPath []string) interface{} {
+		if currency != "" && subPath[0] != currency {
+			return nil
+		}
+
+		orderBooks[subPath[0]] = &OrderBook{}
+		return orderBooks[subPath[0]]
+	}); err != nil {
+		return nil, err
+	}
+
+	return orderBooks, nil
+}
+
+// ListOrders returns the orders of the currency on the exchange, keyed by the currency and the order id
+// joined by a dot, e.g. "BTC/USDT.12345", since the ids of different currencies may collide.
+// The orders of every currency are returned if the currency is empty.
+func (i *Interactor) ListOrders(exchangeName string, currency string) (map[string]*Order, error) {
+	path := []string{exchangeName}
+	if currency != "" {
+		path = append(path, currency)
+	}
+
+	orders := make(map[string]*Order)
+
+	if err := i.scan("Order", path, func(subPath []string) interface{} {
+		if currency != "" {
+			subPath = append([]string{currency}, subPath...)
+		}
+
+		key := strings.Join(subPath, ".")
+		orders[key] = &Order{}
+		return orders[key]
+	}); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
 }
 
-func NewInteractor(connector Connector) *Interactor {
-	return &Interactor{
+func NewInteractor(connector Connector, options ...InteractorOption) *Interactor {
+	i := &Interactor{
 		connector: connector,
+		codec:     JSONCodec{},
 	}
+
+	for _, option := range options {
+		option(i)
+	}
+
+	return i
 }
@@ -1,8 +1,13 @@
 package database
 
 import (
+	"database/sql"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"testing"
+
+	"markets/pkg/metrics"
 )
 
 func TestInteractor_Base(t *testing.T) {
@@ -152,3 +157,263 @@ func TestInteractor_OrderBook(t *testing.T) {
 		t.Errorf("Interactor Delete Error: '%s'", err)
 	}
 }
+
+func TestInteractor_Codec(t *testing.T) {
+	testBalance := Balance{
+		Free:  100000,
+		Used:  20000,
+		Total: 120000,
+	}
+
+	connector := NewInternalConnector()
+	jsonInteractor := NewInteractor(connector)
+	msgPackInteractor := NewInteractor(connector, WithCodec(MsgPackCodec{}))
+
+	if err := jsonInteractor.SetBalance("TestExchange", "JSON_CURRENCY", &testBalance); err != nil {
+		t.Errorf("Interactor SetBalance Error: '%s'", err)
+	}
+
+	if err := msgPackInteractor.SetBalance("TestExchange", "MSGPACK_CURRENCY", &testBalance); err != nil {
+		t.Errorf("Interactor SetBalance Error: '%s'", err)
+	}
+
+	if dataStringPointer, err := connector.Get("Balance", "TestExchange.MSGPACK_CURRENCY"); err != nil {
+		t.Errorf("Connector Get Error: '%s'", err)
+	} else if (*dataStringPointer)[0] != CodecVersionMsgPack {
+		t.Errorf("Interactor Codec Error: Expected version byte %d, got %d", CodecVersionMsgPack, (*dataStringPointer)[0])
+	}
+
+	// Both interactors should be able to read the values written by each other.
+	for _, interactor := range []*Interactor{jsonInteractor, msgPackInteractor} {
+		for _, currency := range []string{"JSON_CURRENCY", "MSGPACK_CURRENCY"} {
+			if dataPointer, err := interactor.GetBalance("TestExchange", currency); err != nil {
+				t.Errorf("Interactor GetBalance Error: '%s'", err)
+			} else if !reflect.DeepEqual(*dataPointer, testBalance) {
+				t.Errorf("Interactor GetBalance Error: Expected '%v', got '%v'", testBalance, *dataPointer)
+			}
+		}
+	}
+}
+
+func TestInteractor_Codec_SQL(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "markets.sqlite"))
+	if err != nil {
+		t.Fatalf("SQLConnector Open Error: %v", err)
+	}
+
+	connector, err := NewSQLConnector(db)
+	if err != nil {
+		t.Fatalf("SQLConnector Migrate Error: %v", err)
+	}
+	defer connector.Close()
+
+	// The typed tables decode the values written by any codec.
+	interactor := NewInteractor(connector, WithCodec(MsgPackCodec{}))
+
+	testBalance := Balance{Free: 1, Used: 0.5, Total: 1.5}
+	testOrder := Order{Id: "123456789", Type: "limit", Side: "buy", Price: 20000, Amount: 1, Status: "open"}
+	testOrderBook := OrderBook{
+		Asks: map[string]string{"20001": "1"},
+		Bids: map[string]string{"19999": "2"},
+	}
+
+	if err := interactor.SetBalance("TestExchange", "BTC", &testBalance); err != nil {
+		t.Errorf("Interactor SetBalance Error: '%s'", err)
+	}
+
+	if err := interactor.SetOrder("TestExchange", "BTC/USDT", testOrder.Id, &testOrder); err != nil {
+		t.Errorf("Interactor SetOrder Error: '%s'", err)
+	}
+
+	if err := interactor.SetOrderBook("TestExchange", "BTC/USDT", &testOrderBook); err != nil {
+		t.Errorf("Interactor SetOrderBook Error: '%s'", err)
+	}
+
+	if dataPointer, err := interactor.GetBalance("TestExchange", "BTC"); err != nil {
+		t.Errorf("Interactor GetBalance Error: '%s'", err)
+	} else if !reflect.DeepEqual(*dataPointer, testBalance) {
+		t.Errorf("Interactor GetBalance Error: Expected '%v', got '%v'", testBalance, *dataPointer)
+	}
+
+	if dataPointer, err := interactor.GetOrder("TestExchange", "BTC/USDT", testOrder.Id); err != nil {
+		t.Errorf("Interactor GetOrder Error: '%s'", err)
+	} else if !reflect.DeepEqual(*dataPointer, testOrder) {
+		t.Errorf("Interactor GetOrder Error: Expected '%v', got '%v'", testOrder, *dataPointer)
+	}
+
+	if dataPointer, err := interactor.GetOrderBook("TestExchange", "BTC/USDT"); err != nil {
+		t.Errorf("Interactor GetOrderBook Error: '%s'", err)
+	} else if !reflect.DeepEqual(*dataPointer, testOrderBook) {
+		t.Errorf("Interactor GetOrderBook Error: Expected '%v', got '%v'", testOrderBook, *dataPointer)
+	}
+}
+
+func generateBenchmarkOrderBook() *OrderBook {
+	orderBook := &OrderBook{
+		Asks: make(map[string]string),
+		Bids: make(map[string]string),
+	}
+
+	for index := 0; index < 50; index++ {
+		orderBook.Asks[strconv.FormatFloat(20000+float64(index)*0.1, 'f', 1, 64)] = "0.12345678"
+		orderBook.Bids[strconv.FormatFloat(19999-float64(index)*0.1, 'f', 1, 64)] = "0.12345678"
+	}
+
+	return orderBook
+}
+
+func benchmarkInteractorSetOrderBook(b *testing.B, codec Codec) {
+	interactor := NewInteractor(NewInternalConnector(), WithCodec(codec))
+	orderBook := generateBenchmarkOrderBook()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if err := interactor.SetOrderBook("TestExchange", "BTC/USDT", orderBook); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInteractor_SetOrderBook_JSON(b *testing.B) {
+	benchmarkInteractorSetOrderBook(b, JSONCodec{})
+}
+
+func BenchmarkInteractor_SetOrderBook_MsgPack(b *testing.B) {
+	benchmarkInteractorSetOrderBook(b, MsgPackCodec{})
+}
+
+func TestInteractor_List(t *testing.T) {
+	interactor := NewInteractor(NewInternalConnector())
+
+	for _, exchangeName := range []string{"TestExchange", "TestExchange2"} {
+		for _, currency := range []string{"BTC/USDT", "ETH/USDT"} {
+			if err := interactor.SetBalance(exchangeName, currency, &Balance{Free: 1, Total: 1}); err != nil {
+				t.Errorf("Interactor SetBalance Error: '%s'", err)
+			}
+
+			if err := interactor.SetFee(exchangeName, currency, &Fee{Maker: 0.1, Taker: 0.2}); err != nil {
+				t.Errorf("Interactor SetFee Error: '%s'", err)
+			}
+
+			if err := interactor.SetOrderBook(exchangeName, currency, &OrderBook{}); err != nil {
+				t.Errorf("Interactor SetOrderBook Error: '%s'", err)
+			}
+
+			for _, orderId := range []string{"1", "2"} {
+				if err := interactor.SetOrder(exchangeName, currency, currency+orderId, &Order{Id: currency + orderId}); err != nil {
+					t.Errorf("Interactor SetOrder Error: '%s'", err)
+				}
+			}
+		}
+	}
+
+	if balances, err := interactor.ListBalances("TestExchange", ""); err != nil {
+		t.Errorf("Interactor ListBalances Error: '%s'", err)
+	} else if len(balances) != 2 || balances["BTC/USDT"] == nil || balances["ETH/USDT"] == nil {
+		t.Errorf("Interactor ListBalances Error: Unexpected balances '%v'", balances)
+	}
+
+	if fees, err := interactor.ListFees("TestExchange", ""); err != nil {
+		t.Errorf("Interactor ListFees Error: '%s'", err)
+	} else if len(fees) != 2 || fees["BTC/USDT"].Taker != 0.2 {
+		t.Errorf("Interactor ListFees Error: Unexpected fees '%v'", fees)
+	}
+
+	if orderBooks, err := interactor.ListOrderBooks("TestExchange2", ""); err != nil {
+		t.Errorf("Interactor ListOrderBooks Error: '%s'", err)
+	} else if len(orderBooks) != 2 {
+		t.Errorf("Interactor ListOrderBooks Error: Unexpected order books '%v'", orderBooks)
+	}
+
+	if orders, err := interactor.ListOrders("TestExchange", "BTC/USDT"); err != nil {
+		t.Errorf("Interactor ListOrders Error: '%s'", err)
+	} else if len(orders) != 2 || orders["BTC/USDT.BTC/USDT1"] == nil || orders["BTC/USDT.BTC/USDT2"] == nil {
+		t.Errorf("Interactor ListOrders Error: Unexpected orders '%v'", orders)
+	}
+
+	if orders, err := interactor.ListOrders("TestExchange", ""); err != nil {
+		t.Errorf("Interactor ListOrders Error: '%s'", err)
+	} else if len(orders) != 4 {
+		t.Errorf("Interactor ListOrders Error: Expected 4 orders, got %d", len(orders))
+	}
+
+	if balances, err := interactor.ListBalances("TestExchange", "ETH/USDT"); err != nil {
+		t.Errorf("Interactor ListBalances Error: '%s'", err)
+	} else if len(balances) != 1 || balances["ETH/USDT"] == nil {
+		t.Errorf("Interactor ListBalances Error: Unexpected balances of the currency '%v'", balances)
+	}
+
+	if fees, err := interactor.ListFees("TestExchange", "BTC/USDT"); err != nil {
+		t.Errorf("Interactor ListFees Error: '%s'", err)
+	} else if len(fees) != 1 || fees["BTC/USDT"] == nil {
+		t.Errorf("Interactor ListFees Error: Unexpected fees of the currency '%v'", fees)
+	}
+
+	if orderBooks, err := interactor.ListOrderBooks("TestExchange2", "BTC/USDT"); err != nil {
+		t.Errorf("Interactor ListOrderBooks Error: '%s'", err)
+	} else if len(orderBooks) != 1 || orderBooks["BTC/USDT"] == nil {
+		t.Errorf("Interactor ListOrderBooks Error: Unexpected order books of the currency '%v'", orderBooks)
+	}
+
+	// The same order id on different currencies is kept apart.
+	for _, currency := range []string{"BTC/USDT", "ETH/USDT"} {
+		if err := interactor.SetOrder("TestExchange", currency, "shared", &Order{Id: "shared", Side: currency}); err != nil {
+			t.Errorf("Interactor SetOrder Error: '%s'", err)
+		}
+	}
+
+	if orders, err := interactor.ListOrders("TestExchange", ""); err != nil {
+		t.Errorf("Interactor ListOrders Error: '%s'", err)
+	} else if orders["BTC/USDT.shared"] == nil || orders["BTC/USDT.shared"].Side != "BTC/USDT" ||
+		orders["ETH/USDT.shared"] == nil || orders["ETH/USDT.shared"].Side != "ETH/USDT" {
+		t.Errorf("Interactor ListOrders Error: The orders with the same id overwrite each other '%v'", orders)
+	}
+
+	if orders, err := interactor.ListOrders("UnknownExchange", ""); err != nil {
+		t.Errorf("Interactor ListOrders Error: '%s'", err)
+	} else if len(orders) != 0 {
+		t.Errorf("Interactor ListOrders Error: Expected no orders, got %d", len(orders))
+	}
+}
+
+func TestInteractor_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	interactorMetrics := NewMetrics(registry)
+
+	connector, err := NewBoltConnector(filepath.Join(t.TempDir(), "markets.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interactor := NewInteractor(connector, WithMetrics(interactorMetrics))
+
+	if err := interactor.SetBalance("okx", "USDT", &Balance{Total: 1}); err != nil {
+		t.Errorf("Interactor SetBalance Error: '%s'", err)
+	}
+
+	if err := interactor.SetOrderBook("okx", "BTC/USDT", &OrderBook{}); err != nil {
+		t.Errorf("Interactor SetOrderBook Error: '%s'", err)
+	}
+
+	if err := connector.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := interactor.SetBalance("okx", "USDT", &Balance{Total: 2}); err == nil {
+		t.Errorf("Interactor SetBalance Error: expected an error after closing the connector")
+	}
+
+	if count := interactorMetrics.WriteDuration.With("Balance").Count(); count != 2 {
+		t.Errorf("Interactor Metrics Error: expected 2 writes of the balances, got %d", count)
+	}
+
+	if count := interactorMetrics.WriteDuration.With("OrderBook").Count(); count != 1 {
+		t.Errorf("Interactor Metrics Error: expected 1 write of the order books, got %d", count)
+	}
+
+	if errors := interactorMetrics.WriteErrors.With("Balance").Value(); errors != 1 {
+		t.Errorf("Interactor Metrics Error: expected 1 failed write, got %v", errors)
+	}
+}
@@ -0,0 +1,325 @@
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy decides which records in a region should be pruned.
+type RetentionPolicy interface {
+	Name() string
+	// Apply prunes the records and returns the number of pruned records.
+	Apply(interactor *Interactor, now time.Time) (int, error)
+}
+
+// terminalOrderStatuses are the statuses of the orders which will never be updated again.
+var terminalOrderStatuses = map[string]bool{
+	"finished":         true,
+	"canceled":         true,
+	"partial canceled": true,
+}
+
+// parseOrderTime parses the time of the orders, which is a unix timestamp in seconds
+// or milliseconds depending on the exchange, or an RFC 3339 string.
+func parseOrderTime(value string) (time.Time, bool) {
+	if timestamp, err := strconv.ParseFloat(value, 64); err == nil {
+		if timestamp >= 1e12 {
+			return time.UnixMilli(int64(timestamp)), true
+		}
+
+		return time.Unix(int64(timestamp), 0), true
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// collect returns the raw key-value pairs in the region, the records are pruned after the scan
+// because some connectors can't be written while scanning.
+func collect(interactor *Interactor, region string) (map[string]string, error) {
+	records := make(map[string]string)
+
+	if err := interactor.connector.Scan(region, "", func(key string, value *string) error {
+		records[key] = *value
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ArchiveOrdersPolicy moves the terminal orders not updated for MaxAge out of the Order region.
+// The orders are copied to ArchiveRegion and appended to ArchivePath as JSON lines if they are set,
+// otherwise the orders are dropped.
+type ArchiveOrdersPolicy struct {
+	MaxAge        time.Duration
+	ArchiveRegion string
+	ArchivePath   string
+}
+
+func (p *ArchiveOrdersPolicy) Name() string {
+	return "archive_orders"
+}
+
+func (p *ArchiveOrdersPolicy) Apply(interactor *Interactor, now time.Time) (int, error) {
+	records, err := collect(interactor, "Order")
+	if err != nil {
+		return 0, err
+	}
+
+	var archiveFile *os.File
+	if p.ArchivePath != "" {
+		if archiveFile, err = os.OpenFile(p.ArchivePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return 0, err
+		}
+		defer archiveFile.Close()
+	}
+
+	pruned := 0
+
+	for key, value := range records {
+		var order Order
+		if err := decodeWithCodec(value, &order); err != nil {
+			continue
+		}
+
+		if !terminalOrderStatuses[order.Status] {
+			continue
+		}
+
+		if updateTime, ok := parseOrderTime(order.UpdateTime); !ok || now.Sub(updateTime) < p.MaxAge {
+			continue
+		}
+
+		if p.ArchiveRegion != "" {
+			if err := interactor.connector.Set(p.ArchiveRegion, key, &value); err != nil {
+				return pruned, err
+			}
+		}
+
+		if archiveFile != nil {
+			if dataBytes, err := json.Marshal(map[string]interface{}{
+				"key":   key,
+				"order": order,
+			}); err != nil {
+				return pruned, err
+			} else if _, err := archiveFile.Write(append(dataBytes, '\n')); err != nil {
+				return pruned, err
+			}
+		}
+
+		if err := interactor.connector.Delete("Order", key); err != nil {
+			return pruned, err
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// DropZeroBalancesPolicy drops the balances whose total is zero.
+type DropZeroBalancesPolicy struct{}
+
+func (p *DropZeroBalancesPolicy) Name() string {
+	return "drop_zero_balances"
+}
+
+func (p *DropZeroBalancesPolicy) Apply(interactor *Interactor, _ time.Time) (int, error) {
+	records, err := collect(interactor, "Balance")
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+
+	for key, value := range records {
+		var balance Balance
+		if err := decodeWithCodec(value, &balance); err != nil {
+			continue
+		}
+
+		if balance.Total != 0 || balance.Free != 0 || balance.Used != 0 {
+			continue
+		}
+
+		if err := interactor.connector.Delete("Balance", key); err != nil {
+			return pruned, err
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// PurgeOrderBooksPolicy purges the order books of the pairs which are not subscribed anymore.
+// Subscribed returns the subscribed currencies keyed by exchange name,
+// the order books of the exchanges not in the result are kept.
+type PurgeOrderBooksPolicy struct {
+	Subscribed func() map[string][]string
+}
+
+func (p *PurgeOrderBooksPolicy) Name() string {
+	return "purge_order_books"
+}
+
+func (p *PurgeOrderBooksPolicy) Apply(interactor *Interactor, _ time.Time) (int, error) {
+	subscribed := make(map[string]map[string]bool)
+	for exchangeName, currencies := range p.Subscribed() {
+		subscribed[exchangeName] = make(map[string]bool)
+		for _, currency := range currencies {
+			subscribed[exchangeName][currency] = true
+		}
+	}
+
+	records, err := collect(interactor, "OrderBook")
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+
+	for key := range records {
+		path := strings.SplitN(key, ".", 2)
+		if len(path) != 2 {
+			continue
+		}
+
+		if currencies, ok := subscribed[path[0]]; !ok || currencies[path[1]] {
+			continue
+		}
+
+		if err := interactor.connector.Delete("OrderBook", key); err != nil {
+			return pruned, err
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// JanitorMetrics is the statistics of a retention policy.
+type JanitorMetrics struct {
+	Runs        int
+	Errors      int
+	Pruned      int
+	LastPruned  int
+	LastRunTime time.Time
+	LastError   error
+}
+
+// Janitor applies the retention policies periodically in background.
+type Janitor struct {
+	interactor *Interactor
+	interval   time.Duration
+	policies   []RetentionPolicy
+
+	metricsMux sync.Mutex
+	metrics    map[string]*JanitorMetrics
+
+	stop chan bool
+	done chan bool
+}
+
+// RunOnce applies every policy once, the first error is returned after all policies are applied.
+func (j *Janitor) RunOnce() error {
+	var firstErr error
+
+	for _, policy := range j.policies {
+		now := time.Now()
+		pruned, err := policy.Apply(j.interactor, now)
+
+		j.metricsMux.Lock()
+		metrics := j.metrics[policy.Name()]
+		metrics.Runs++
+		metrics.Pruned += pruned
+		metrics.LastPruned = pruned
+		metrics.LastRunTime = now
+		metrics.LastError = err
+		if err != nil {
+			metrics.Errors++
+		}
+		j.metricsMux.Unlock()
+
+		j.interactor.metrics.observeRetention(policy.Name(), pruned, err)
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Metrics returns a copy of the statistics keyed by policy name.
+func (j *Janitor) Metrics() map[string]JanitorMetrics {
+	j.metricsMux.Lock()
+	defer j.metricsMux.Unlock()
+
+	metrics := make(map[string]JanitorMetrics)
+	for name, value := range j.metrics {
+		metrics[name] = *value
+	}
+
+	return metrics
+}
+
+func (j *Janitor) Start() {
+	if j.stop != nil {
+		return
+	}
+
+	j.stop = make(chan bool)
+	j.done = make(chan bool)
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				_ = j.RunOnce()
+			}
+		}
+	}()
+}
+
+func (j *Janitor) Stop() {
+	if j.stop == nil {
+		return
+	}
+
+	close(j.stop)
+	<-j.done
+	j.stop = nil
+}
+
+func NewJanitor(interactor *Interactor, interval time.Duration, policies ...RetentionPolicy) *Janitor {
+	j := &Janitor{
+		interactor: interactor,
+		interval:   interval,
+		policies:   policies,
+		metrics:    make(map[string]*JanitorMetrics),
+	}
+
+	for _, policy := range policies {
+		j.metrics[policy.Name()] = &JanitorMetrics{}
+	}
+
+	return j
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"markets/pkg/metrics"
+)
+
+func TestJanitor(t *testing.T) {
+	storageMetrics := NewMetrics(metrics.NewRegistry())
+	interactor := NewInteractor(NewInternalConnector(), WithMetrics(storageMetrics))
+	archivePath := filepath.Join(t.TempDir(), "orders.jsonl")
+
+	oldTime := strconv.FormatInt(time.Now().Add(-48*time.Hour).UnixMilli(), 10)
+	newTime := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	orders := map[string]*Order{
+		"old_finished": {Id: "old_finished", Status: "finished", UpdateTime: oldTime},
+		"old_live":     {Id: "old_live", Status: "created", UpdateTime: oldTime},
+		"new_canceled": {Id: "new_canceled", Status: "canceled", UpdateTime: newTime},
+	}
+
+	for orderId, order := range orders {
+		if err := interactor.SetOrder("TestExchange", "BTC/USDT", orderId, order); err != nil {
+			t.Errorf("Interactor SetOrder Error: '%s'", err)
+		}
+	}
+
+	if err := interactor.SetBalance("TestExchange", "BTC", &Balance{}); err != nil {
+		t.Errorf("Interactor SetBalance Error: '%s'", err)
+	}
+
+	if err := interactor.SetBalance("TestExchange", "USDT", &Balance{Free: 1, Total: 1}); err != nil {
+		t.Errorf("Interactor SetBalance Error: '%s'", err)
+	}
+
+	for _, currency := range []string{"BTC/USDT", "ETH/USDT"} {
+		if err := interactor.SetOrderBook("TestExchange", currency, &OrderBook{}); err != nil {
+			t.Errorf("Interactor SetOrderBook Error: '%s'", err)
+		}
+	}
+
+	janitor := NewJanitor(interactor, time.Hour,
+		&ArchiveOrdersPolicy{MaxAge: 24 * time.Hour, ArchiveRegion: "OrderArchive", ArchivePath: archivePath},
+		&DropZeroBalancesPolicy{},
+		&PurgeOrderBooksPolicy{Subscribed: func() map[string][]string {
+			return map[string][]string{"TestExchange": {"BTC/USDT"}}
+		}},
+	)
+
+	if err := janitor.RunOnce(); err != nil {
+		t.Errorf("Janitor RunOnce Error: '%s'", err)
+	}
+
+	if remaining, err := interactor.ListOrders("TestExchange", "BTC/USDT"); err != nil {
+		t.Errorf("Interactor ListOrders Error: '%s'", err)
+	} else if len(remaining) != 2 || remaining["BTC/USDT.old_finished"] != nil {
+		t.Errorf("Janitor Error: Unexpected remaining orders '%v'", remaining)
+	}
+
+	if _, err := interactor.GetString("OrderArchive", "TestExchange.BTC/USDT.old_finished"); err != nil {
+		t.Errorf("Janitor Error: The order is not archived to the region: '%s'", err)
+	}
+
+	if archiveFile, err := os.Open(archivePath); err != nil {
+		t.Errorf("Janitor Error: The archive file is not created: '%s'", err)
+	} else {
+		lines := 0
+		scanner := bufio.NewScanner(archiveFile)
+		for scanner.Scan() {
+			lines++
+		}
+		_ = archiveFile.Close()
+
+		if lines != 1 {
+			t.Errorf("Janitor Error: Expected 1 archived order in file, got %d", lines)
+		}
+	}
+
+	if balances, err := interactor.ListBalances("TestExchange", ""); err != nil {
+		t.Errorf("Interactor ListBalances Error: '%s'", err)
+	} else if len(balances) != 1 || balances["USDT"] == nil {
+		t.Errorf("Janitor Error: Unexpected remaining balances '%v'", balances)
+	}
+
+	if orderBooks, err := interactor.ListOrderBooks("TestExchange", ""); err != nil {
+		t.Errorf("Interactor ListOrderBooks Error: '%s'", err)
+	} else if len(orderBooks) != 1 || orderBooks["BTC/USDT"] == nil {
+		t.Errorf("Janitor Error: Unexpected remaining order books '%v'", orderBooks)
+	}
+
+	janitorMetrics := janitor.Metrics()
+	for name, pruned := range map[string]int{"archive_orders": 1, "drop_zero_balances": 1, "purge_order_books": 1} {
+		if janitorMetrics[name].Runs != 1 || janitorMetrics[name].Pruned != pruned {
+			t.Errorf("Janitor Metrics Error: Unexpected metrics of %s '%v'", name, janitorMetrics[name])
+		}
+
+		// The statistics are also exported through the metrics of the interactor.
+		if storageMetrics.RetentionRuns.With(name).Value() != 1 || storageMetrics.RetentionPruned.With(name).Value() != float64(pruned) ||
+			storageMetrics.RetentionErrors.With(name).Value() != 0 {
+			t.Errorf("Janitor Metrics Error: The policy %s is not exported", name)
+		}
+	}
+
+	janitor.Start()
+	janitor.Stop()
+}
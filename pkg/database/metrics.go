@@ -0,0 +1,67 @@
+package database
+
+import (
+	"time"
+
+	"markets/pkg/metrics"
+)
+
+// Metrics measures the writes of the Interactors, which share it, by region,
+// and the retention policies applied by the Janitors of the Interactors, by policy.
+type Metrics struct {
+	WriteDuration *metrics.HistogramVec
+	WriteErrors   *metrics.CounterVec
+
+	RetentionRuns   *metrics.CounterVec
+	RetentionPruned *metrics.CounterVec
+	RetentionErrors *metrics.CounterVec
+}
+
+// NewMetrics registers the metrics of the writes and the retention in the registry.
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		WriteDuration: registry.Histogram("markets_storage_write_duration_seconds",
+			"The duration of the writes to the storage.", nil, "region"),
+		WriteErrors: registry.Counter("markets_storage_write_errors_total",
+			"The writes to the storage which have failed.", "region"),
+
+		RetentionRuns: registry.Counter("markets_storage_retention_runs_total",
+			"The times the retention policy has been applied.", "policy"),
+		RetentionPruned: registry.Counter("markets_storage_retention_pruned_total",
+			"The records pruned by the retention policy.", "policy"),
+		RetentionErrors: registry.Counter("markets_storage_retention_errors_total",
+			"The runs of the retention policy which have failed.", "policy"),
+	}
+}
+
+// observeWrite records the write to the region which has started at the time.
+func (m *Metrics) observeWrite(region string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	m.WriteDuration.With(region).ObserveSince(start)
+	if err != nil {
+		m.WriteErrors.With(region).Inc()
+	}
+}
+
+// observeRetention records a run of the retention policy which has pruned the records.
+func (m *Metrics) observeRetention(policy string, pruned int, err error) {
+	if m == nil {
+		return
+	}
+
+	m.RetentionRuns.With(policy).Inc()
+	m.RetentionPruned.With(policy).Add(float64(pruned))
+	if err != nil {
+		m.RetentionErrors.With(policy).Inc()
+	}
+}
+
+// WithMetrics measures the writes of the Interactor and the policies of its Janitors, they are not measured by default.
+func WithMetrics(m *Metrics) InteractorOption {
+	return func(i *Interactor) {
+		i.metrics = m
+	}
+}
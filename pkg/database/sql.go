@@ -0,0 +1,503 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// sqlMigrations are applied in order, the index + 1 is the schema version.
+// Never change a released migration, append a new one instead.
+var sqlMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS kv (
+		region TEXT NOT NULL,
+		key    TEXT NOT NULL,
+		value  TEXT NOT NULL,
+		PRIMARY KEY (region, key)
+	);
+	CREATE TABLE IF NOT EXISTS balances (
+		exchange TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		free     REAL NOT NULL,
+		used     REAL NOT NULL,
+		total    REAL NOT NULL,
+		PRIMARY KEY (exchange, currency)
+	);
+	CREATE TABLE IF NOT EXISTS fees (
+		exchange TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		maker    REAL NOT NULL,
+		taker    REAL NOT NULL,
+		PRIMARY KEY (exchange, currency)
+	);
+	CREATE TABLE IF NOT EXISTS orders (
+		exchange       TEXT NOT NULL,
+		currency       TEXT NOT NULL,
+		order_id       TEXT NOT NULL,
+		type           TEXT NOT NULL,
+		side           TEXT NOT NULL,
+		create_time_ms TEXT NOT NULL,
+		update_time_ms TEXT NOT NULL,
+		price          REAL NOT NULL,
+		filled_price   REAL NOT NULL,
+		amount         REAL NOT NULL,
+		filled         REAL NOT NULL,
+		left_amount    REAL NOT NULL,
+		status         TEXT NOT NULL,
+		fee            REAL NOT NULL,
+		fee_currency   TEXT NOT NULL,
+		PRIMARY KEY (exchange, currency, order_id)
+	);
+	CREATE TABLE IF NOT EXISTS order_books (
+		exchange TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		PRIMARY KEY (exchange, currency)
+	);
+	CREATE TABLE IF NOT EXISTS order_book_levels (
+		exchange TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		side     TEXT NOT NULL,
+		price    TEXT NOT NULL,
+		amount   TEXT NOT NULL,
+		PRIMARY KEY (exchange, currency, side, price)
+	);`,
+}
+
+// SQLConnector is a connector that stores the values in a SQL database.
+// Balance, Fee, Order and OrderBook are stored in typed tables keyed by exchange and currency,
+// the other regions are stored in a generic key-value table.
+// The statements are written for SQLite, the driver is chosen by the caller.
+// The typed regions are decoded by any known codec and read back as JSON, so the Interactor may use any of them.
+type SQLConnector struct {
+	db *sql.DB
+}
+
+func (c *SQLConnector) migrate() error {
+	if _, err := c.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	var version int
+	if err := c.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for index := version; index < len(sqlMigrations); index++ {
+		tx, err := c.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		for _, statement := range strings.Split(sqlMigrations[index], ";") {
+			if strings.TrimSpace(statement) == "" {
+				continue
+			}
+
+			if _, err := tx.Exec(statement); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, index+1); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitMarketKey splits the key generated by Interactor.GenerateKeyWithPath into exchange and currency.
+func splitMarketKey(key string) (string, string, error) {
+	path := strings.SplitN(key, ".", 2)
+	if len(path) != 2 {
+		return "", "", errors.New("invalid key " + key)
+	}
+
+	return path[0], path[1], nil
+}
+
+// splitOrderKey splits the key of an order into exchange, currency and order id.
+func splitOrderKey(key string) (string, string, string, error) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first < 0 || first == last {
+		return "", "", "", errors.New("invalid key " + key)
+	}
+
+	return key[:first], key[first+1 : last], key[last+1:], nil
+}
+
+func (c *SQLConnector) Set(region string, key string, valuePointer *string) error {
+	switch region {
+	case "Balance":
+		exchange, currency, err := splitMarketKey(key)
+		if err != nil {
+			return err
+		}
+
+		var balance Balance
+		if err := decodeWithCodec(*valuePointer, &balance); err != nil {
+			return err
+		}
+
+		_, err = c.db.Exec(`INSERT INTO balances (exchange, currency, free, used, total) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (exchange, currency) DO UPDATE SET free = excluded.free, used = excluded.used, total = excluded.total`,
+			exchange, currency, balance.Free, balance.Used, balance.Total)
+		return err
+	case "Fee":
+		exchange, currency, err := splitMarketKey(key)
+		if err != nil {
+			return err
+		}
+
+		var fee Fee
+		if err := decodeWithCodec(*valuePointer, &fee); err != nil {
+			return err
+		}
+
+		_, err = c.db.Exec(`INSERT INTO fees (exchange, currency, maker, taker) VALUES (?, ?, ?, ?)
+			ON CONFLICT (exchange, currency) DO UPDATE SET maker = excluded.maker, taker = excluded.taker`,
+			exchange, currency, fee.Maker, fee.Taker)
+		return err
+	case "Order":
+		exchange, currency, orderId, err := splitOrderKey(key)
+		if err != nil {
+			return err
+		}
+
+		var order Order
+		if err := decodeWithCodec(*valuePointer, &order); err != nil {
+			return err
+		}
+
+		_, err = c.db.Exec(`INSERT INTO orders (exchange, currency, order_id, type, side, create_time_ms, update_time_ms,
+				price, filled_price, amount, filled, left_amount, status, fee, fee_currency)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (exchange, currency, order_id) DO UPDATE SET type = excluded.type, side = excluded.side,
+				create_time_ms = excluded.create_time_ms, update_time_ms = excluded.update_time_ms,
+				price = excluded.price, filled_price = excluded.filled_price, amount = excluded.amount,
+				filled = excluded.filled, left_amount = excluded.left_amount, status = excluded.status,
+				fee = excluded.fee, fee_currency = excluded.fee_currency`,
+			exchange, currency, orderId, order.Type, order.Side, order.CreateTime, order.UpdateTime,
+			order.Price, order.FilledPrice, order.Amount, order.FilledAmount, order.LeftAmount, order.Status,
+			order.Fee, order.FeeCurrency)
+		return err
+	case "OrderBook":
+		exchange, currency, err := splitMarketKey(key)
+		if err != nil {
+			return err
+		}
+
+		var orderBook OrderBook
+		if err := decodeWithCodec(*valuePointer, &orderBook); err != nil {
+			return err
+		}
+
+		return c.setOrderBook(exchange, currency, &orderBook)
+	default:
+		_, err := c.db.Exec(`INSERT INTO kv (region, key, value) VALUES (?, ?, ?)
+			ON CONFLICT (region, key) DO UPDATE SET value = excluded.value`,
+			region, key, *valuePointer)
+		return err
+	}
+}
+
+func (c *SQLConnector) setOrderBook(exchange string, currency string, orderBook *OrderBook) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO order_books (exchange, currency) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		exchange, currency); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM order_book_levels WHERE exchange = ? AND currency = ?`,
+		exchange, currency); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	statement, err := tx.Prepare(`INSERT INTO order_book_levels (exchange, currency, side, price, amount) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer statement.Close()
+
+	for side, levels := range map[string]map[string]string{"ask": orderBook.Asks, "bid": orderBook.Bids} {
+		for price, amount := range levels {
+			if _, err := statement.Exec(exchange, currency, side, price, amount); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (c *SQLConnector) Get(region string, key string) (*string, error) {
+	var value interface{}
+
+	switch region {
+	case "Balance":
+		exchange, currency, err := splitMarketKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		var balance Balance
+		if err := c.db.QueryRow(`SELECT free, used, total FROM balances WHERE exchange = ? AND currency = ?`,
+			exchange, currency).Scan(&balance.Free, &balance.Used, &balance.Total); err != nil {
+			return nil, err
+		}
+
+		value = &balance
+	case "Fee":
+		exchange, currency, err := splitMarketKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		var fee Fee
+		if err := c.db.QueryRow(`SELECT maker, taker FROM fees WHERE exchange = ? AND currency = ?`,
+			exchange, currency).Scan(&fee.Maker, &fee.Taker); err != nil {
+			return nil, err
+		}
+
+		value = &fee
+	case "Order":
+		exchange, currency, orderId, err := splitOrderKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		order := Order{Id: orderId}
+		if err := c.db.QueryRow(`SELECT type, side, create_time_ms, update_time_ms, price, filled_price,
+				amount, filled, left_amount, status, fee, fee_currency
+			FROM orders WHERE exchange = ? AND currency = ? AND order_id = ?`,
+			exchange, currency, orderId).Scan(&order.Type, &order.Side, &order.CreateTime, &order.UpdateTime,
+			&order.Price, &order.FilledPrice, &order.Amount, &order.FilledAmount, &order.LeftAmount,
+			&order.Status, &order.Fee, &order.FeeCurrency); err != nil {
+			return nil, err
+		}
+
+		value = &order
+	case "OrderBook":
+		exchange, currency, err := splitMarketKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		orderBook, err := c.getOrderBook(exchange, currency)
+		if err != nil {
+			return nil, err
+		}
+
+		value = orderBook
+	default:
+		var data string
+		if err := c.db.QueryRow(`SELECT value FROM kv WHERE region = ? AND key = ?`,
+			region, key).Scan(&data); err != nil {
+			return nil, err
+		}
+
+		return &data, nil
+	}
+
+	if dataBytes, err := json.Marshal(value); err != nil {
+		return nil, err
+	} else {
+		dataString := string(dataBytes)
+		return &dataString, nil
+	}
+}
+
+func (c *SQLConnector) getOrderBook(exchange string, currency string) (*OrderBook, error) {
+	var found int
+	if err := c.db.QueryRow(`SELECT COUNT(*) FROM order_books WHERE exchange = ? AND currency = ?`,
+		exchange, currency).Scan(&found); err != nil {
+		return nil, err
+	} else if found == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := c.db.Query(`SELECT side, price, amount FROM order_book_levels WHERE exchange = ? AND currency = ?`,
+		exchange, currency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orderBook := &OrderBook{
+		Asks: make(map[string]string),
+		Bids: make(map[string]string),
+	}
+
+	for rows.Next() {
+		var side, price, amount string
+		if err := rows.Scan(&side, &price, &amount); err != nil {
+			return nil, err
+		}
+
+		if side == "ask" {
+			orderBook.Asks[price] = amount
+		} else {
+			orderBook.Bids[price] = amount
+		}
+	}
+
+	return orderBook, rows.Err()
+}
+
+func (c *SQLConnector) Delete(region string, key string) error {
+	var result sql.Result
+	var err error
+
+	switch region {
+	case "Balance", "Fee":
+		exchange, currency, splitErr := splitMarketKey(key)
+		if splitErr != nil {
+			return splitErr
+		}
+
+		table := map[string]string{"Balance": "balances", "Fee": "fees"}[region]
+		result, err = c.db.Exec(`DELETE FROM `+table+` WHERE exchange = ? AND currency = ?`, exchange, currency)
+	case "Order":
+		exchange, currency, orderId, splitErr := splitOrderKey(key)
+		if splitErr != nil {
+			return splitErr
+		}
+
+		result, err = c.db.Exec(`DELETE FROM orders WHERE exchange = ? AND currency = ? AND order_id = ?`,
+			exchange, currency, orderId)
+	case "OrderBook":
+		exchange, currency, splitErr := splitMarketKey(key)
+		if splitErr != nil {
+			return splitErr
+		}
+
+		if _, err := c.db.Exec(`DELETE FROM order_book_levels WHERE exchange = ? AND currency = ?`,
+			exchange, currency); err != nil {
+			return err
+		}
+
+		result, err = c.db.Exec(`DELETE FROM order_books WHERE exchange = ? AND currency = ?`, exchange, currency)
+	default:
+		result, err = c.db.Exec(`DELETE FROM kv WHERE region = ? AND key = ?`, region, key)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return errors.New("key not found")
+	}
+
+	return nil
+}
+
+// sqlKeyExpressions are the expressions rebuilding the keys of the typed regions from the columns.
+var sqlKeyExpressions = map[string]struct {
+	table      string
+	expression string
+}{
+	"Balance":   {"balances", `exchange || '.' || currency`},
+	"Fee":       {"fees", `exchange || '.' || currency`},
+	"Order":     {"orders", `exchange || '.' || currency || '.' || order_id`},
+	"OrderBook": {"order_books", `exchange || '.' || currency`},
+}
+
+func (c *SQLConnector) Keys(region string, prefix string) ([]string, error) {
+	var rows *sql.Rows
+	var err error
+
+	if keyExpression, ok := sqlKeyExpressions[region]; ok {
+		rows, err = c.db.Query(`SELECT `+keyExpression.expression+` AS key FROM `+keyExpression.table+`
+			WHERE substr(`+keyExpression.expression+`, 1, length(?)) = ? ORDER BY key`, prefix, prefix)
+	} else {
+		rows, err = c.db.Query(`SELECT key FROM kv WHERE region = ? AND substr(key, 1, length(?)) = ? ORDER BY key`,
+			region, prefix, prefix)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (c *SQLConnector) Scan(region string, prefix string, handler func(key string, value *string) error) error {
+	keys, err := c.Keys(region, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		value, err := c.Get(region, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted after listing the keys.
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := handler(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DB returns the underlying database handle for running analytical queries.
+func (c *SQLConnector) DB() *sql.DB {
+	return c.db
+}
+
+// Ping checks the connection to the database.
+func (c *SQLConnector) Ping() error {
+	return c.db.Ping()
+}
+
+func (c *SQLConnector) Close() error {
+	return c.db.Close()
+}
+
+// NewSQLConnector creates the connector and migrates the schema to the latest version.
+func NewSQLConnector(db *sql.DB) (*SQLConnector, error) {
+	c := &SQLConnector{
+		db: db,
+	}
+
+	if err := c.migrate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
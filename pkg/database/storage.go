@@ -0,0 +1,154 @@
+package database
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// The storage types built by NewConnector.
+const (
+	StorageMemory = "memory"
+	StorageRedis  = "redis"
+	StorageBolt   = "bolt"
+	StorageSQL    = "sql"
+)
+
+type RedisStorageOptions struct {
+	// Addr is localhost:6379 by default.
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	// TLS connects with TLS, the certificate is not verified if TLSSkipVerify is set.
+	TLS           bool
+	TLSSkipVerify bool
+}
+
+type BoltStorageOptions struct {
+	Path    string
+	Options BoltOptions
+}
+
+// SQLStorageOptions opens the database with database/sql, the driver must be registered by the caller,
+// e.g. by importing modernc.org/sqlite.
+type SQLStorageOptions struct {
+	Driver string
+	DSN    string
+}
+
+// StorageOptions selects the connector and its options, only the options of the type are used.
+type StorageOptions struct {
+	Type  string
+	Redis RedisStorageOptions
+	Bolt  BoltStorageOptions
+	SQL   SQLStorageOptions
+	// Logger receives the events of the storage, slog.Default() is used if it is nil.
+	Logger *slog.Logger
+}
+
+func newRedisOptions(options *RedisStorageOptions) *redis.Options {
+	redisOptions := &redis.Options{
+		Addr:     options.Addr,
+		Username: options.Username,
+		Password: options.Password,
+		DB:       options.DB,
+	}
+
+	if redisOptions.Addr == "" {
+		redisOptions.Addr = "localhost:6379"
+	}
+
+	if options.TLS {
+		redisOptions.TLSConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: options.TLSSkipVerify,
+		}
+	}
+
+	return redisOptions
+}
+
+// NewConnector builds the connector of the storage type, a single connector is meant to be shared
+// by all exchanges through their Interactors.
+func NewConnector(options *StorageOptions) (Connector, error) {
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	logger = logger.With("storage", options.Type)
+
+	switch options.Type {
+	case StorageMemory:
+		return NewInternalConnector(), nil
+	case StorageRedis:
+		redisOptions := newRedisOptions(&options.Redis)
+		logger.Info("using redis", "addr", redisOptions.Addr, "db", redisOptions.DB, "tls", options.Redis.TLS)
+
+		return NewRedisConnector(redisOptions), nil
+	case StorageBolt:
+		if options.Bolt.Path == "" {
+			return nil, errors.New("the path of the bolt storage is required")
+		}
+
+		boltOptions := options.Bolt.Options
+		if boltOptions.Logger == nil {
+			boltOptions.Logger = logger
+		}
+
+		logger.Info("opening the bolt database", "path", options.Bolt.Path)
+		return NewBoltConnector(options.Bolt.Path, &boltOptions)
+	case StorageSQL:
+		if options.SQL.Driver == "" || options.SQL.DSN == "" {
+			return nil, errors.New("the driver and the dsn of the sql storage are required")
+		}
+
+		logger.Info("opening the sql database", "driver", options.SQL.Driver)
+
+		db, err := sql.Open(options.SQL.Driver, options.SQL.DSN)
+		if err != nil {
+			return nil, err
+		}
+
+		if connector, err := NewSQLConnector(db); err != nil {
+			_ = db.Close()
+			return nil, err
+		} else {
+			return connector, nil
+		}
+	default:
+		return nil, errors.New("unsupported storage type: " + options.Type)
+	}
+}
+
+// PingConnector checks that the storage of the connector is reachable,
+// the connectors which keep the data in memory are always reachable.
+func PingConnector(connector Connector) error {
+	if pinger, ok := connector.(interface{ Ping() error }); ok {
+		return pinger.Ping()
+	}
+
+	return nil
+}
+
+// CloseConnector flushes the pending writes of the connector to disk and closes it,
+// the connectors which have nothing to flush or close are left as they are.
+func CloseConnector(connector Connector) error {
+	var firstErr error
+
+	if syncer, ok := connector.(interface{ Sync() error }); ok {
+		firstErr = syncer.Sync()
+	}
+
+	if closer, ok := connector.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
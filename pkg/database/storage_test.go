@@ -0,0 +1,64 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNewConnector(t *testing.T) {
+	directory := t.TempDir()
+
+	for _, options := range []*StorageOptions{
+		{Type: StorageMemory},
+		{Type: StorageBolt, Bolt: BoltStorageOptions{Path: filepath.Join(directory, "markets.db")}},
+		{Type: StorageSQL, SQL: SQLStorageOptions{Driver: "sqlite", DSN: filepath.Join(directory, "markets.sqlite")}},
+	} {
+		c, err := NewConnector(options)
+		if err != nil {
+			t.Errorf("NewConnector Error: %s: %v", options.Type, err)
+			continue
+		}
+
+		interactor := NewInteractor(c)
+		if err := interactor.SetBalance("okx", "USDT", &Balance{Free: 1, Total: 1}); err != nil {
+			t.Errorf("NewConnector Error: %s: %v", options.Type, err)
+		} else if balance, err := interactor.GetBalance("okx", "USDT"); err != nil || balance.Total != 1 {
+			t.Errorf("NewConnector Error: %s: %v, %v", options.Type, balance, err)
+		}
+
+		if err := PingConnector(c); err != nil {
+			t.Errorf("PingConnector Error: %s: %v", options.Type, err)
+		}
+
+		if err := CloseConnector(c); err != nil {
+			t.Errorf("CloseConnector Error: %s: %v", options.Type, err)
+		}
+
+		// The file databases can't be written once they are closed.
+		if err := interactor.SetBalance("okx", "USDT", &Balance{}); err == nil && options.Type != StorageMemory {
+			t.Errorf("CloseConnector Error: %s is still open", options.Type)
+		}
+
+		if err := PingConnector(c); err == nil && options.Type != StorageMemory {
+			t.Errorf("PingConnector Error: %s is still reachable after close", options.Type)
+		}
+	}
+
+	// The redis client connects lazily.
+	if c, err := NewConnector(&StorageOptions{Type: StorageRedis, Redis: RedisStorageOptions{DB: 2, TLS: true}}); err != nil {
+		t.Errorf("NewConnector Error: redis: %v", err)
+	} else if options := c.(*RedisConnector).client.Options(); options.Addr != "localhost:6379" || options.DB != 2 || options.TLSConfig == nil {
+		t.Errorf("NewConnector Error: unexpected redis options %v", options)
+	}
+
+	for _, options := range []*StorageOptions{
+		{Type: ""},
+		{Type: "mongodb"},
+		{Type: StorageBolt},
+		{Type: StorageSQL, SQL: SQLStorageOptions{Driver: "sqlite"}},
+	} {
+		if _, err := NewConnector(options); err == nil {
+			t.Errorf("NewConnector Error: expected an error for %v", options)
+		}
+	}
+}
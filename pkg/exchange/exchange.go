@@ -1,23 +1,75 @@
 package exchange
 
 import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"markets/pkg/database"
+	"markets/pkg/logging"
+	"markets/pkg/wsclt"
 )
 
 type Exchanger interface {
+	// Start connects and subscribes, the exchange is stopped again if it fails.
 	Start() error
 	Stop() error
+	// UpdateCurrencies subscribes the added currencies and unsubscribes the removed ones without reconnecting.
+	UpdateCurrencies(currencies []string) error
+	// Ping checks the credentials with an authenticated request of the rest api, the exchange does not need to be started.
+	Ping() error
 }
 
 type Exchange struct {
+	// runningMux serializes Stop, which is called by both the owner and the disconnection watcher.
+	runningMux               sync.Mutex
 	running                  bool
 	publicDisconnectedSignal chan bool
 	name                     string
 	database                 *database.Interactor
 	aliveSignalInterval      time.Duration
-	currencies               []string
+	pongTimeout              time.Duration
+
+	// runMux guards the channels of the current run and why it has failed, they are replaced by Start.
+	runMux  sync.Mutex
+	stopped chan struct{}
+	failed  chan struct{}
+	runErr  error
+
+	// cacheMux guards the currencies and the order book caches of the exchanges,
+	// which are changed by UpdateCurrencies while the messages are handled.
+	cacheMux   sync.Mutex
+	currencies []string
+
+	recordDirectory string
+	recorders       []*wsclt.FileRecorder
+
+	proxy string
+
+	// The schemes and the hosts of the APIs, they can be pointed to a fake exchange in tests.
+	websocketApiURL url.URL
+	restApiURL      url.URL
+
+	maxSubscriptionsPerConnection int
+
+	// channels are the subscribed channels, all channels are subscribed if it is nil.
+	channels map[string]bool
+
+	latency latencyTracker
+	pending pendingRequests
+	metrics *Metrics
+
+	healthState healthState
+	// connectionsMux guards the connections of the adapters, which are replaced by Start while Health reads them.
+	connectionsMux sync.Mutex
+
+	// logger carries the name of the exchange, websocketLogger falls back to it if it is nil.
+	logger          *slog.Logger
+	websocketLogger *slog.Logger
 }
 
 func (e *Exchange) GetName() string {
@@ -25,9 +77,295 @@ func (e *Exchange) GetName() string {
 }
 
 func (e *Exchange) IsRunning() bool {
+	e.runningMux.Lock()
+	defer e.runningMux.Unlock()
+
 	return e.running
 }
 
+// Done returns a channel which is closed when the current run stops, either by Stop or by itself
+// because a connection is lost or a message can't be handled. It is nil before Start.
+func (e *Exchange) Done() <-chan struct{} {
+	e.runMux.Lock()
+	defer e.runMux.Unlock()
+
+	return e.stopped
+}
+
+// Err returns why the current run has failed, it is nil if it has not failed or has been stopped by Stop.
+func (e *Exchange) Err() error {
+	e.runMux.Lock()
+	defer e.runMux.Unlock()
+
+	return e.runErr
+}
+
+// beginRun replaces the channels of the run, it must be called by Start with runningMux held.
+func (e *Exchange) beginRun() (failed <-chan struct{}, stopped <-chan struct{}) {
+	e.runMux.Lock()
+	defer e.runMux.Unlock()
+
+	e.stopped = make(chan struct{})
+	e.failed = make(chan struct{})
+	e.runErr = nil
+
+	return e.failed, e.stopped
+}
+
+// endRun closes the channel of the current run before the connections are closed,
+// so their errors are not taken for failures. It must be called by Stop with runningMux held.
+func (e *Exchange) endRun() {
+	e.runMux.Lock()
+	defer e.runMux.Unlock()
+
+	select {
+	case <-e.stopped:
+	default:
+		close(e.stopped)
+	}
+}
+
+// isCurrentRun tells whether the channel belongs to the run which has not been stopped yet,
+// it must be called with runningMux held.
+func (e *Exchange) isCurrentRun(stopped <-chan struct{}) bool {
+	e.runMux.Lock()
+	defer e.runMux.Unlock()
+
+	return e.running && e.stopped == stopped
+}
+
+// fail records why the current run has failed and makes the disconnection watcher stop it,
+// only the first reason is kept. It does not block, so it can be called by the message handlers.
+func (e *Exchange) fail(err error) {
+	e.runMux.Lock()
+	defer e.runMux.Unlock()
+
+	if e.failed == nil {
+		return
+	}
+
+	select {
+	case <-e.stopped:
+		return
+	case <-e.failed:
+		return
+	default:
+	}
+
+	e.runErr = err
+	close(e.failed)
+
+	e.logger.Error("the exchange has failed", "error", err)
+}
+
+// Latencies returns the rolling percentiles of the latencies of every channel, keyed by the channel name.
+func (e *Exchange) Latencies() map[string]LatencyStats {
+	return e.latency.stats()
+}
+
+// getCurrencies returns a copy of the currencies.
+func (e *Exchange) getCurrencies() []string {
+	e.cacheMux.Lock()
+	defer e.cacheMux.Unlock()
+
+	return append([]string(nil), e.currencies...)
+}
+
+// replaceCurrencies replaces the currencies and returns the added and the removed ones in order,
+// it must be called with cacheMux held.
+func (e *Exchange) replaceCurrencies(currencies []string) (added []string, removed []string) {
+	current := make(map[string]bool)
+	for _, currency := range e.currencies {
+		current[currency] = true
+	}
+
+	next := make(map[string]bool)
+	for _, currency := range currencies {
+		if !current[currency] && !next[currency] {
+			added = append(added, currency)
+		}
+		next[currency] = true
+	}
+
+	for _, currency := range e.currencies {
+		if !next[currency] {
+			removed = append(removed, currency)
+		}
+	}
+
+	e.currencies = append([]string(nil), currencies...)
+	return added, removed
+}
+
+// newRestClient creates the client of the rest api, which goes through the proxy if it is configured.
+func (e *Exchange) newRestClient() (*http.Client, error) {
+	if e.proxy == "" {
+		return &http.Client{}, nil
+	}
+
+	proxyURL, err := wsclt.ParseProxyURL(e.proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+		},
+	}, nil
+}
+
+// The channels which can be enabled by the Channels setting.
+const (
+	ChannelOrderBook = "orderBook"
+	ChannelOrders    = "orders"
+	ChannelBalances  = "balances"
+)
+
+// Settings is the setting of an exchange, the zero values of the optional settings select the defaults.
+type Settings struct {
+	ApiKey string
+	Secret string
+	// Password is the passphrase of the API key, it is required by OKX.
+	Password string
+	// Proxy is the address of the HTTP CONNECT or SOCKS5 proxy, it is optional.
+	Proxy string
+	// WebsocketApiURL and RestApiURL override the schemes and the hosts of the APIs, e.g. "ws://127.0.0.1:8080".
+	WebsocketApiURL string
+	RestApiURL      string
+	// PingInterval is the interval of the heartbeats, 25 seconds by default.
+	PingInterval time.Duration
+	// MaxSubscriptionsPerConnection limits the order books subscribed on a single connection, 50 by default.
+	MaxSubscriptionsPerConnection int
+	// Channels are the subscribed channels, all channels are subscribed if it is empty.
+	Channels []string
+}
+
+func (e *Exchange) isChannelEnabled(channel string) bool {
+	return e.channels == nil || e.channels[channel]
+}
+
+// apiURL returns the scheme and the host of the API, the default is used if the value is empty.
+func apiURL(value string, key string, defaultURL url.URL) (url.URL, error) {
+	if value == "" {
+		return defaultURL, nil
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return url.URL{}, fmt.Errorf("invalid %s %q", key, value)
+	}
+
+	return url.URL{Scheme: parsed.Scheme, Host: parsed.Host}, nil
+}
+
+// configure applies the optional settings shared by the exchanges, the APIs default to the given URLs.
+func (e *Exchange) configure(settings *Settings, websocketApiURL url.URL, restApiURL url.URL) error {
+	var err error
+
+	switch {
+	case settings.PingInterval < 0:
+		return fmt.Errorf("invalid pingInterval %s", settings.PingInterval)
+	case settings.PingInterval == 0:
+		e.aliveSignalInterval = 25 * time.Second
+	default:
+		e.aliveSignalInterval = settings.PingInterval
+	}
+
+	switch {
+	case settings.MaxSubscriptionsPerConnection < 0:
+		return fmt.Errorf("invalid maxSubscriptionsPerConnection %d", settings.MaxSubscriptionsPerConnection)
+	case settings.MaxSubscriptionsPerConnection == 0:
+		e.maxSubscriptionsPerConnection = 50
+	default:
+		e.maxSubscriptionsPerConnection = settings.MaxSubscriptionsPerConnection
+	}
+
+	e.channels = nil
+	for _, channel := range settings.Channels {
+		switch channel {
+		case ChannelOrderBook, ChannelOrders, ChannelBalances:
+			if e.channels == nil {
+				e.channels = make(map[string]bool)
+			}
+			e.channels[channel] = true
+		default:
+			return fmt.Errorf("invalid channel %q", channel)
+		}
+	}
+
+	if e.websocketApiURL, err = apiURL(settings.WebsocketApiURL, "websocketApiUrl", websocketApiURL); err != nil {
+		return err
+	}
+
+	if e.restApiURL, err = apiURL(settings.RestApiURL, "restApiUrl", restApiURL); err != nil {
+		return err
+	}
+
+	e.proxy = settings.Proxy
+
+	return nil
+}
+
+// EnableRecording records the raw frames of every connection opened by Start to the directory,
+// the recordings can be replayed to reproduce the bugs of the parsers offline.
+func (e *Exchange) EnableRecording(directory string) {
+	e.recordDirectory = directory
+}
+
+// SetLogger sets the logger of the exchange, slog.Default() is used if it is not set.
+func (e *Exchange) SetLogger(logger *slog.Logger) {
+	e.logger = logger.With(logging.KeyExchange, e.name)
+}
+
+// SetWebsocketLogger sets the logger of the connections opened by Start, so their level can be
+// set separately, the logger of the exchange is used if it is not set.
+func (e *Exchange) SetWebsocketLogger(logger *slog.Logger) {
+	e.websocketLogger = logger.With(logging.KeyExchange, e.name)
+}
+
+func (e *Exchange) connectionLogger(connectionName string) *slog.Logger {
+	if e.websocketLogger != nil {
+		return e.websocketLogger.With("connection", connectionName)
+	}
+
+	return e.logger.With("connection", connectionName)
+}
+
+// newRecorder returns a nil recorder if the recording is disabled.
+func (e *Exchange) newRecorder(connectionName string) (wsclt.Recorder, error) {
+	if e.recordDirectory == "" {
+		return nil, nil
+	}
+
+	fileName := fmt.Sprintf("%s-%s-%d.jsonl", e.name, connectionName, time.Now().Unix())
+	recorder, err := wsclt.NewFileRecorder(filepath.Join(e.recordDirectory, fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	e.recorders = append(e.recorders, recorder)
+	return recorder, nil
+}
+
+func (e *Exchange) closeRecorders() error {
+	var firstErr error
+
+	for _, recorder := range e.recorders {
+		if err := recorder.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	e.recorders = nil
+	return firstErr
+}
+
+// messageSender is implemented by both a single connection and a pool of connections.
+type messageSender interface {
+	SendMessage(message []byte) error
+}
+
 type RestApiOption struct {
 	method string
 	path   string
@@ -0,0 +1,107 @@
+package exchangetest
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// The REST responses served by the fake Gate.io, the order book snapshot has the id 100.
+const (
+	GateioFee       = `{"taker_fee":"0.002","maker_fee":"0.002"}`
+	GateioAccounts  = `[{"currency":"BTC","available":"1","locked":"0.5"}]`
+	GateioOrderBook = `{"id":100,"asks":[["20001","1"],["20002","2"]],"bids":[["19999","3"]]}`
+)
+
+type gateioRequest struct {
+	Id      json.RawMessage `json:"id"`
+	Channel string          `json:"channel"`
+	Event   string          `json:"event"`
+	Payload []string        `json:"payload"`
+}
+
+func gateioRespond(message []byte) [][]byte {
+	var request gateioRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	var replies [][]byte
+	reply := func(data map[string]interface{}) {
+		data["time"] = now.Unix()
+		data["time_ms"] = now.UnixMilli()
+		if request.Id != nil {
+			data["id"] = request.Id
+		}
+
+		if dataBytes, err := json.Marshal(data); err == nil {
+			replies = append(replies, dataBytes)
+		}
+	}
+
+	if request.Channel == "spot.ping" {
+		reply(map[string]interface{}{"channel": "spot.pong", "event": "", "error": nil, "result": nil})
+		return replies
+	}
+
+	if request.Event != "subscribe" && request.Event != "unsubscribe" {
+		return nil
+	}
+
+	reply(map[string]interface{}{
+		"channel": request.Channel,
+		"event":   request.Event,
+		"error":   nil,
+		"result":  map[string]string{"status": "success"},
+	})
+
+	if request.Event == "unsubscribe" {
+		return replies
+	}
+
+	switch request.Channel {
+	case "spot.order_book_update":
+		if len(request.Payload) > 0 {
+			replies = append(replies, GateioOrderBookUpdates(request.Payload[0])...)
+		}
+	case "spot.balances":
+		replies = append(replies, []byte(`{"time_ms":`+strconv.FormatInt(now.UnixMilli(), 10)+
+			`,"channel":"spot.balances","event":"update","result":[{"currency":"USDT","available":"10","total":"15"}]}`))
+	}
+
+	return replies
+}
+
+// GateioOrderBookUpdates are the updates sent after subscribing the order book of the currency pair, e.g. BTC_USDT.
+// The first update is ahead of the order book, so the snapshot is fetched through the REST API,
+// then the second update is applied to it. The expected order book is asks {"20002": "2"}
+// and bids {"19999": "3", "19998": "4"}.
+func GateioOrderBookUpdates(currencyPair string) [][]byte {
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	return [][]byte{
+		[]byte(`{"channel":"spot.order_book_update","event":"update","result":{"t":` + timestamp +
+			`,"s":"` + currencyPair + `","U":101,"u":101,"a":[],"b":[]}}`),
+		[]byte(`{"channel":"spot.order_book_update","event":"update","result":{"t":` + timestamp +
+			`,"s":"` + currencyPair + `","U":101,"u":102,"a":[["20001","0"]],"b":[["19998","4"]]}}`),
+	}
+}
+
+// GateioScript answers the heartbeats, the subscriptions and the unsubscriptions of Gate.io.
+func GateioScript() *Script {
+	return &Script{
+		Rest: map[string]string{
+			"GET /api/v4/wallet/fee":      GateioFee,
+			"GET /api/v4/spot/accounts":   GateioAccounts,
+			"GET /api/v4/spot/order_book": GateioOrderBook,
+		},
+		Respond: gateioRespond,
+	}
+}
+
+// NewGateioServer starts a fake Gate.io.
+func NewGateioServer() *Server {
+	return NewServer(GateioScript())
+}
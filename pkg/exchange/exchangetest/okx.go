@@ -0,0 +1,121 @@
+package exchangetest
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// The REST responses served by the fake OKX.
+const (
+	OkxTradeFee      = `{"code":"0","data":[{"maker":"-0.0008","taker":"-0.001"}]}`
+	OkxAccountConfig = `{"code":"0","msg":"","data":[{"uid":"1","acctLv":"1"}]}`
+)
+
+type okxRequest struct {
+	Id   string            `json:"id"`
+	Op   string            `json:"op"`
+	Args []json.RawMessage `json:"args"`
+}
+
+func okxTimestamp() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
+
+func okxRespond(message []byte) [][]byte {
+	return okxReplies(message, true)
+}
+
+// okxRespondWithoutIds answers like okxRespond, but the id of the request is not echoed.
+func okxRespondWithoutIds(message []byte) [][]byte {
+	return okxReplies(message, false)
+}
+
+func okxReplies(message []byte, echoId bool) [][]byte {
+	if string(message) == "ping" {
+		return [][]byte{[]byte("pong")}
+	}
+
+	var request okxRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return nil
+	}
+
+	var replies [][]byte
+	reply := func(data map[string]interface{}) {
+		if echoId && request.Id != "" {
+			data["id"] = request.Id
+		}
+
+		if dataBytes, err := json.Marshal(data); err == nil {
+			replies = append(replies, dataBytes)
+		}
+	}
+
+	switch request.Op {
+	case "login":
+		reply(map[string]interface{}{"event": "login", "code": "0", "msg": ""})
+	case "subscribe":
+		for _, rawArg := range request.Args {
+			var arg struct {
+				Channel string `json:"channel"`
+				InstId  string `json:"instId"`
+			}
+			if err := json.Unmarshal(rawArg, &arg); err != nil {
+				continue
+			}
+
+			reply(map[string]interface{}{"event": "subscribe", "arg": rawArg})
+
+			switch arg.Channel {
+			case "books50-l2-tbt":
+				replies = append(replies, OkxOrderBookSnapshot(arg.InstId), OkxOrderBookUpdate(arg.InstId))
+			case "account":
+				replies = append(replies, []byte(`{"arg":{"channel":"account"},"data":[{"details":[`+
+					`{"ccy":"USDT","availBal":"10","frozenBal":"5","eq":"15"}],"uTime":"`+okxTimestamp()+`"}]}`))
+			}
+		}
+	case "unsubscribe":
+		for _, rawArg := range request.Args {
+			reply(map[string]interface{}{"event": "unsubscribe", "arg": rawArg})
+		}
+	}
+
+	return replies
+}
+
+// OkxOrderBookSnapshot is the snapshot sent after subscribing the order book of the instrument, e.g. BTC-USDT.
+func OkxOrderBookSnapshot(instId string) []byte {
+	return []byte(`{"arg":{"channel":"books50-l2-tbt","instId":"` + instId + `"},"action":"snapshot","data":[` +
+		`{"asks":[["20001","1"],["20002","2"]],"bids":[["19999","3"]],"ts":"` + okxTimestamp() + `"}]}`)
+}
+
+// OkxOrderBookUpdate is the update sent after the snapshot, the expected order book is
+// asks {"20002": "2"} and bids {"19999": "3", "19998": "4"}.
+func OkxOrderBookUpdate(instId string) []byte {
+	return []byte(`{"arg":{"channel":"books50-l2-tbt","instId":"` + instId + `"},"action":"update","data":[` +
+		`{"asks":[["20001","0"]],"bids":[["19998","4"]],"ts":"` + okxTimestamp() + `"}]}`)
+}
+
+// OkxScript answers the heartbeats, the logins, the subscriptions and the unsubscriptions of OKX.
+func OkxScript() *Script {
+	return &Script{
+		Rest: map[string]string{
+			"GET /api/v5/account/trade-fee": OkxTradeFee,
+			"GET /api/v5/account/config":    OkxAccountConfig,
+		},
+		Respond: okxRespond,
+	}
+}
+
+// OkxScriptWithoutIds is OkxScript whose acknowledgements don't echo the ids of the requests.
+func OkxScriptWithoutIds() *Script {
+	script := OkxScript()
+	script.Respond = okxRespondWithoutIds
+	return script
+}
+
+// NewOkxServer starts a fake OKX.
+func NewOkxServer() *Server {
+	return NewServer(OkxScript())
+}
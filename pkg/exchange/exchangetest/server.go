@@ -0,0 +1,155 @@
+// Package exchangetest provides an in-process fake exchange serving canned WebSocket frames and REST responses,
+// so the exchanges can be started and stopped in tests without the network.
+package exchangetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Script describes how the fake exchange behaves.
+type Script struct {
+	// Rest maps "METHOD /path" to the body of the response, the other requests get 404.
+	Rest map[string]string
+	// Respond returns the frames sent back for a frame received from a connection,
+	// e.g. the pong of a ping, the acknowledgement of a login, or the snapshot of a subscribed order book.
+	Respond func(message []byte) [][]byte
+}
+
+// Server serves the WebSocket API on every path of its address, and the REST API on the paths of the script.
+type Server struct {
+	// URL is the base URL of the WebSocket API, e.g. ws://127.0.0.1:1234.
+	URL string
+	// RestURL is the base URL of the REST API, e.g. http://127.0.0.1:1234.
+	RestURL string
+
+	script   *Script
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mux      sync.Mutex
+	conns    map[*websocket.Conn]*sync.Mutex
+	received []string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWebSocket(w, r)
+		return
+	}
+
+	if body, ok := s.script.Rest[r.Method+" "+r.URL.Path]; ok {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	writeMux := &sync.Mutex{}
+
+	s.mux.Lock()
+	s.conns[conn] = writeMux
+	s.mux.Unlock()
+
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, conn)
+		s.mux.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		s.mux.Lock()
+		s.received = append(s.received, string(message))
+		s.mux.Unlock()
+
+		if s.script.Respond == nil {
+			continue
+		}
+
+		for _, reply := range s.script.Respond(message) {
+			writeMux.Lock()
+			err := conn.WriteMessage(websocket.TextMessage, reply)
+			writeMux.Unlock()
+
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Send pushes the frame to every open connection, e.g. an order update.
+func (s *Server) Send(message []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for conn, writeMux := range s.conns {
+		writeMux.Lock()
+		_ = conn.WriteMessage(websocket.TextMessage, message)
+		writeMux.Unlock()
+	}
+}
+
+// Disconnect drops every open connection without the close handshake, as a network failure does.
+func (s *Server) Disconnect() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// Connections returns the number of open connections.
+func (s *Server) Connections() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return len(s.conns)
+}
+
+// Received returns the frames received from all connections in order.
+func (s *Server) Received() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]string(nil), s.received...)
+}
+
+func (s *Server) Close() {
+	s.Disconnect()
+	s.server.Close()
+}
+
+// NewServer starts the fake exchange, it should be closed by the caller.
+func NewServer(script *Script) *Server {
+	s := &Server{
+		script: script,
+		conns:  make(map[*websocket.Conn]*sync.Mutex),
+	}
+
+	s.server = httptest.NewServer(s)
+	s.RestURL = s.server.URL
+	s.URL = "ws" + strings.TrimPrefix(s.server.URL, "http")
+
+	return s
+}
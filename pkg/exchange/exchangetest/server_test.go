@@ -0,0 +1,88 @@
+package exchangetest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"markets/pkg/wsclt"
+)
+
+func TestServer(t *testing.T) {
+	server := NewOkxServer()
+	defer server.Close()
+
+	if resp, err := http.Get(server.RestURL + "/api/v5/account/trade-fee"); err != nil {
+		t.Fatal(err)
+	} else {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if string(body) != OkxTradeFee {
+			t.Errorf("Rest Error: got %s", body)
+		}
+	}
+
+	if resp, err := http.Get(server.RestURL + "/api/v5/unknown"); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Rest Error: expected 404, got %d", resp.StatusCode)
+		}
+	}
+
+	received := make(chan string, 16)
+	clt := wsclt.NewClient(&wsclt.Options{
+		PingInterval: time.Hour,
+		MessageHandler: func(msg []byte) {
+			received <- string(msg)
+		},
+	})
+
+	if err := clt.Connect(context.Background(), server.URL+"/ws/v5/public"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := clt.SendMessage([]byte(`{"op":"subscribe","args":[{"channel":"books50-l2-tbt","instId":"BTC-USDT"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(substring string) {
+		select {
+		case message := <-received:
+			if !strings.Contains(message, substring) {
+				t.Errorf("Expected a message containing %s, got %s", substring, message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s", substring)
+		}
+	}
+
+	expect(`"event":"subscribe"`)
+	expect(`"action":"snapshot"`)
+	expect(`"action":"update"`)
+
+	server.Send([]byte(`{"event":"notice"}`))
+	expect(`"event":"notice"`)
+
+	if received := server.Received(); len(received) != 1 || !strings.Contains(received[0], "subscribe") {
+		t.Errorf("Expected the subscription to be received, got %v", received)
+	}
+
+	server.Disconnect()
+
+	select {
+	case <-clt.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("The client is not disconnected")
+	}
+
+	if clt.Err() == nil {
+		t.Error("Expected the reason of the disconnection")
+	}
+}
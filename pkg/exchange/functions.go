@@ -8,8 +8,11 @@ func updateOrderBook(
 	asksData [][]string,
 	bidsData [][]string,
 ) {
-	if fullMode {
+	if fullMode || originalOrderBook.Asks == nil {
 		originalOrderBook.Asks = make(map[string]string)
+	}
+
+	if fullMode || originalOrderBook.Bids == nil {
 		originalOrderBook.Bids = make(map[string]string)
 	}
 
@@ -1,6 +1,7 @@
 package exchange
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
@@ -8,15 +9,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
-	"os/signal"
 	"strconv"
 	"strings"
 	"time"
 
 	"markets/pkg/database"
+	"markets/pkg/logging"
 	"markets/pkg/wsclt"
 )
 
@@ -30,6 +31,20 @@ const (
 	GateioRestApiPath     = "/api/v4"
 )
 
+// gateioHeartbeat pings on the spot.ping channel, the spot.pong replies are not passed to the handler.
+var gateioHeartbeat = &wsclt.JSONHeartbeat{
+	Build: func() []byte {
+		return []byte(fmt.Sprintf(`{"time":%d,"channel":"spot.ping"}`, time.Now().Unix()))
+	},
+	IsPongMessage: func(message []byte) bool {
+		var data struct {
+			Channel string `json:"channel"`
+		}
+
+		return json.Unmarshal(message, &data) == nil && data.Channel == "spot.pong"
+	},
+}
+
 type gateioFeeResult struct {
 	TakerFeeRate string `json:"taker_fee"`
 	MakerFeeRate string `json:"maker_fee"`
@@ -42,7 +57,9 @@ type gateioBalanceRestApiResult struct {
 }
 
 type gateioBalanceWebSocketApiResult struct {
-	Result []struct {
+	Channel string `json:"channel"`
+	TimeMs  int64  `json:"time_ms"`
+	Result  []struct {
 		Currency  string `json:"currency"`
 		Available string `json:"available"`
 		Total     string `json:"total"`
@@ -56,7 +73,9 @@ type gateioOrderBookRestApiResult struct {
 }
 
 type gateioOrderBookWebSocketApiResult struct {
-	Result struct {
+	Channel string `json:"channel"`
+	Result  struct {
+		UpdateTime     int64      `json:"t"`
 		GateioCurrency string     `json:"s"`
 		FirstUpdate    int64      `json:"U"`
 		LastUpdate     int64      `json:"u"`
@@ -66,7 +85,9 @@ type gateioOrderBookWebSocketApiResult struct {
 }
 
 type gateioOrderResult struct {
-	Data []struct {
+	Channel string `json:"channel"`
+	TimeMs  int64  `json:"time_ms"`
+	Data    []struct {
 		Id               string `json:"id"`
 		CreateTime       string `json:"create_time"`
 		UpdateTime       string `json:"update_time"`
@@ -83,6 +104,15 @@ type gateioOrderResult struct {
 	} `json:"result"`
 }
 
+// gateioResponse is the common part of the responses of the requests.
+type gateioResponse struct {
+	Id    *uint64 `json:"id"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
 type gateioCacheOrderBook struct {
 	Id   int64
 	Data *database.OrderBook
@@ -93,6 +123,7 @@ type Gateio struct {
 
 	restClient *http.Client
 	wsClient   *wsclt.Client
+	wsPool     *wsclt.Pool
 
 	messages chan []byte
 
@@ -121,7 +152,7 @@ func (e *Gateio) updateFee() error {
 			fee.Maker, _ = strconv.ParseFloat(result.MakerFeeRate, 64)
 			fee.Taker, _ = strconv.ParseFloat(result.TakerFeeRate, 64)
 
-			for _, currency := range e.currencies {
+			for _, currency := range e.getCurrencies() {
 				if err := e.database.SetFee(e.name, currency, fee); err != nil {
 					return err
 				}
@@ -148,7 +179,7 @@ func (e *Gateio) initializeOrderBook(currency string) error {
 	if data, err := e.RestApi(restApiOption); err != nil {
 		return err
 	} else {
-		e.orderBookCache[currency] = &gateioCacheOrderBook{
+		orderBook := &gateioCacheOrderBook{
 			Id:   0,
 			Data: &database.OrderBook{},
 		}
@@ -157,46 +188,68 @@ func (e *Gateio) initializeOrderBook(currency string) error {
 		if err := json.Unmarshal(data, &result); err != nil {
 			return err
 		} else {
-			e.orderBookCache[currency].Id = result.Id
+			orderBook.Id = result.Id
 
-			updateOrderBook(true, e.orderBookCache[currency].Data, result.Asks, result.Bids)
+			updateOrderBook(true, orderBook.Data, result.Asks, result.Bids)
 
-			if err := e.database.SetOrderBook(e.name, currency, e.orderBookCache[currency].Data); err != nil {
+			// The currency may have been removed while the snapshot was requested.
+			e.cacheMux.Lock()
+			_, ok := e.orderBookCache[currency]
+			if ok {
+				e.orderBookCache[currency] = orderBook
+			}
+			e.cacheMux.Unlock()
+
+			if !ok {
+				return nil
+			}
+
+			if err := e.database.SetOrderBook(e.name, currency, orderBook.Data); err != nil {
 				return err
 			}
+
+			e.healthState.setBookSynced(currency, true)
 		}
 	}
 
 	return nil
 }
 
-func (e *Gateio) updateOrderBook(message []byte) error {
+func (e *Gateio) updateOrderBook(message []byte, receivedTime time.Time) error {
 	var result gateioOrderBookWebSocketApiResult
 	err := json.Unmarshal(message, &result)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
 
 	currency := e.convertToGeneralCurrencyString(result.Result.GateioCurrency)
 
-	if orderBook, ok := e.orderBookCache[currency]; ok {
+	e.cacheMux.Lock()
+	orderBook, ok := e.orderBookCache[currency]
+	e.cacheMux.Unlock()
+
+	// The updates of an unsubscribed currency may still arrive before the unsubscription is acknowledged.
+	if ok {
 		if orderBook.Id+1 >= result.Result.FirstUpdate && orderBook.Id+1 <= result.Result.LastUpdate {
 			updateOrderBook(false, orderBook.Data, result.Result.Asks, result.Result.Bids)
 			orderBook.Id = result.Result.LastUpdate
 			if err := e.database.SetOrderBook(e.name, currency, orderBook.Data); err != nil {
 				return err
 			}
+
+			e.latency.record(result.Channel, millisecondTime(result.Result.UpdateTime), receivedTime, time.Now())
 		} else if orderBook.Id+1 > result.Result.LastUpdate {
 			return nil
 		} else if orderBook.Id+1 < result.Result.FirstUpdate {
+			e.logger.Info("resynchronizing the order book", logging.KeyChannel, result.Channel, logging.KeyCurrency, currency,
+				"id", orderBook.Id, "firstUpdate", result.Result.FirstUpdate)
+			e.healthState.setBookSynced(currency, false)
+			e.recordResync(currency)
 			err := e.initializeOrderBook(currency)
 			if err != nil {
 				return err
 			}
 		}
-	} else {
-		return errors.New("gateio: order book not found" + currency)
 	}
 
 	return nil
@@ -204,14 +257,14 @@ func (e *Gateio) updateOrderBook(message []byte) error {
 
 func (e *Gateio) initializeBalance() error {
 	if e.restClient == nil {
-		panic(errors.New("the rest api client is not ready"))
+		return errors.New("the rest api client is not ready")
 	}
 
 	if data, err := e.RestApi(&RestApiOption{
 		method: "GET",
 		path:   "/spot/accounts",
 	}); err != nil {
-		panic(err)
+		return err
 	} else {
 		var result []gateioBalanceRestApiResult
 		if err := json.Unmarshal(data, &result); err != nil {
@@ -234,7 +287,7 @@ func (e *Gateio) initializeBalance() error {
 	return nil
 }
 
-func (e *Gateio) updateBalance(message []byte) error {
+func (e *Gateio) updateBalance(message []byte, receivedTime time.Time) error {
 	var result gateioBalanceWebSocketApiResult
 	if err := json.Unmarshal(message, &result); err != nil {
 		return err
@@ -251,10 +304,12 @@ func (e *Gateio) updateBalance(message []byte) error {
 		}
 	}
 
+	e.latency.record(result.Channel, millisecondTime(result.TimeMs), receivedTime, time.Now())
+
 	return nil
 }
 
-func (e *Gateio) updateOrder(message []byte) error {
+func (e *Gateio) updateOrder(message []byte, receivedTime time.Time) error {
 	var result gateioOrderResult
 	if err := json.Unmarshal(message, &result); err != nil {
 		return err
@@ -310,12 +365,37 @@ func (e *Gateio) updateOrder(message []byte) error {
 		}
 	}
 
+	e.latency.record(result.Channel, millisecondTime(result.TimeMs), receivedTime, time.Now())
+
 	return nil
 }
 
+// resolveRequest hands the response of a request sent by Request to the caller waiting for it.
+func (e *Gateio) resolveRequest(message []byte) bool {
+	var response gateioResponse
+	if err := json.Unmarshal(message, &response); err != nil || response.Id == nil {
+		return false
+	}
+
+	var err error
+	if response.Error != nil {
+		err = &RequestError{Code: strconv.Itoa(response.Error.Code), Message: response.Error.Message}
+	}
+
+	return e.pending.resolve(strconv.FormatUint(*response.Id, 10), message, err)
+}
+
 func (e *Gateio) handleMessage(message []byte) {
+	receivedTime := time.Now()
+	e.healthState.received(receivedTime)
+
 	var data map[string]interface{}
 	if err := json.Unmarshal(message, &data); err != nil {
+		e.recordParseError()
+		return
+	}
+
+	if _, ok := data["id"]; ok && e.resolveRequest(message) {
 		return
 	}
 
@@ -325,10 +405,14 @@ func (e *Gateio) handleMessage(message []byte) {
 			if event, ok := data["event"]; ok {
 				switch event {
 				case "subscribe":
-					fmt.Println("Subscribe to order book")
+					e.healthState.subscribed(channel.(string))
+					e.logger.Info("subscribed", logging.KeyChannel, channel)
 				case "update":
-					if err := e.updateOrderBook(message); err != nil {
-						panic(err)
+					err := e.updateOrderBook(message, receivedTime)
+					e.recordUpdate(channel.(string), err)
+					if err != nil {
+						// The state can't be trusted after a failed update, so the run is started again.
+						e.fail(fmt.Errorf("can't update the order book: %w", err))
 					}
 				}
 			}
@@ -336,10 +420,14 @@ func (e *Gateio) handleMessage(message []byte) {
 			if event, ok := data["event"]; ok {
 				switch event {
 				case "subscribe":
-					fmt.Println("Subscribe to order")
+					e.healthState.subscribed(channel.(string))
+					e.logger.Info("subscribed", logging.KeyChannel, channel)
 				case "update":
-					if err := e.updateOrder(message); err != nil {
-						panic(err)
+					err := e.updateOrder(message, receivedTime)
+					e.recordUpdate(channel.(string), err)
+					if err != nil {
+						// The state can't be trusted after a failed update, so the run is started again.
+						e.fail(fmt.Errorf("can't update the orders: %w", err))
 					}
 				}
 			}
@@ -347,10 +435,14 @@ func (e *Gateio) handleMessage(message []byte) {
 			if event, ok := data["event"]; ok {
 				switch event {
 				case "subscribe":
-					fmt.Println("Subscribe to balance")
+					e.healthState.subscribed(channel.(string))
+					e.logger.Info("subscribed", logging.KeyChannel, channel)
 				case "update":
-					if err := e.updateBalance(message); err != nil {
-						panic(err)
+					err := e.updateBalance(message, receivedTime)
+					e.recordUpdate(channel.(string), err)
+					if err != nil {
+						// The state can't be trusted after a failed update, so the run is started again.
+						e.fail(fmt.Errorf("can't update the balances: %w", err))
 					}
 				}
 			}
@@ -366,8 +458,17 @@ func (e *Gateio) convertToGateioCurrencyString(generalCurrencyString string) str
 	return strings.Replace(generalCurrencyString, "/", "_", -1)
 }
 
+// connections returns the connections opened by the last Start, which may replace them at any time.
+func (e *Gateio) connections() (*wsclt.Pool, *wsclt.Client) {
+	e.connectionsMux.Lock()
+	defer e.connectionsMux.Unlock()
+
+	return e.wsPool, e.wsClient
+}
+
 func (e *Gateio) SendMessageRawBytes(dataBytes []byte) error {
-	if err := e.wsClient.SendMessage(dataBytes); err != nil {
+	_, wsClient := e.connections()
+	if err := wsClient.SendMessage(dataBytes); err != nil {
 		return err
 	} else {
 		return nil
@@ -375,6 +476,25 @@ func (e *Gateio) SendMessageRawBytes(dataBytes []byte) error {
 }
 
 func (e *Gateio) SendMessageJSON(data map[string]interface{}) error {
+	if dataBytes, err := e.signMessageJSON(data); err != nil {
+		return err
+	} else {
+		return e.SendMessageRawBytes(dataBytes)
+	}
+}
+
+// Request signs and sends the request, e.g. a subscription, on the connection of the orders and
+// the balances, and waits for the response with the same id. The response is returned as it is,
+// a RequestError is returned if the exchange reports an error, and the context error if it times out.
+func (e *Gateio) Request(ctx context.Context, payload map[string]interface{}) ([]byte, error) {
+	return e.request(ctx, func(id uint64) error {
+		payload["id"] = id
+		return e.SendMessageJSON(payload)
+	})
+}
+
+// signMessageJSON adds the timestamp and the signature to the message.
+func (e *Gateio) signMessageJSON(data map[string]interface{}) ([]byte, error) {
 	var channel, event string
 
 	if value, ok := data["channel"]; ok {
@@ -398,82 +518,201 @@ func (e *Gateio) SendMessageJSON(data map[string]interface{}) error {
 		"SIGN":   sign,
 	}
 
-	if dataBytes, err := json.Marshal(data); err != nil {
-		return err
-	} else {
-		return e.SendMessageRawBytes(dataBytes)
-	}
+	return json.Marshal(data)
 }
 
-func (e *Gateio) subscribe() {
-	// Order Book
-	for _, currency := range e.currencies {
-		gateioCurrency := e.convertToGateioCurrencyString(currency)
-		params := map[string]interface{}{
+// buildOrderBookMessages builds the messages of the event, e.g. subscribe, for the order books of the gateio currencies on a connection.
+func (e *Gateio) buildOrderBookMessages(event string, gateioCurrencies []string) ([][]byte, error) {
+	messages := make([][]byte, 0, len(gateioCurrencies))
+
+	for _, gateioCurrency := range gateioCurrencies {
+		dataBytes, err := e.signMessageJSON(map[string]interface{}{
 			"channel": "spot.order_book_update",
-			"event":   "subscribe",
+			"event":   event,
 			"payload": []string{gateioCurrency, "100ms"},
+		})
+		if err != nil {
+			return nil, err
 		}
 
-		if err := e.SendMessageJSON(params); err != nil {
-			panic(err)
-		}
+		messages = append(messages, dataBytes)
 	}
 
-	// Order
-	{
-		currencies := make([]string, 0)
+	return messages, nil
+}
+
+func (e *Gateio) buildOrderBookSubscribe(gateioCurrencies []string) ([][]byte, error) {
+	return e.buildOrderBookMessages("subscribe", gateioCurrencies)
+}
+
+func (e *Gateio) buildOrderBookUnsubscribe(gateioCurrencies []string) ([][]byte, error) {
+	return e.buildOrderBookMessages("unsubscribe", gateioCurrencies)
+}
+
+func (e *Gateio) convertToGateioCurrencyStrings(currencies []string) []string {
+	gateioCurrencies := make([]string, 0, len(currencies))
+
+	for _, currency := range currencies {
+		gateioCurrencies = append(gateioCurrencies, e.convertToGateioCurrencyString(currency))
+	}
 
-		for _, currency := range e.currencies {
-			currencies = append(currencies, e.convertToGateioCurrencyString(currency))
+	return gateioCurrencies
+}
+
+func (e *Gateio) subscribe() error {
+	// Order Book
+	if e.isChannelEnabled(ChannelOrderBook) {
+		if err := e.wsPool.Subscribe(e.convertToGateioCurrencyStrings(e.getCurrencies())...); err != nil {
+			return err
 		}
+	}
 
+	// Order
+	if e.isChannelEnabled(ChannelOrders) {
 		params := map[string]interface{}{
 			"channel": "spot.orders",
 			"event":   "subscribe",
-			"payload": currencies,
+			"payload": e.convertToGateioCurrencyStrings(e.getCurrencies()),
 		}
 
-		if err := e.SendMessageJSON(params); err != nil {
-			panic(err)
+		if _, err := e.Request(context.Background(), params); err != nil {
+			return err
+		} else {
+			e.healthState.subscribed("spot.orders")
 		}
 	}
 
 	// balance
-	{
+	if e.isChannelEnabled(ChannelBalances) {
 		params := map[string]interface{}{
 			"time":    time.Now().Unix(),
 			"channel": "spot.balances",
 			"event":   "subscribe",
 		}
 
-		if err := e.SendMessageJSON(params); err != nil {
-			panic(err)
+		if _, err := e.Request(context.Background(), params); err != nil {
+			return err
+		} else {
+			e.healthState.subscribed("spot.balances")
 		}
 	}
+
+	return nil
 }
 
-func (e *Gateio) waitForDisconnecting() {
-	// Handle SIGINT and SIGTERM.
-	interruptSignal := make(chan os.Signal, 1)
-	signal.Notify(interruptSignal, os.Interrupt)
-	defer close(interruptSignal)
+// UpdateCurrencies subscribes the added currencies and unsubscribes the removed ones without reconnecting,
+// the order books of the removed currencies are dropped from the cache and the database.
+func (e *Gateio) UpdateCurrencies(currencies []string) error {
+	e.cacheMux.Lock()
+	added, removed := e.replaceCurrencies(currencies)
+	for _, currency := range added {
+		e.orderBookCache[currency] = &gateioCacheOrderBook{
+			Id:   0,
+			Data: &database.OrderBook{},
+		}
+	}
+	e.cacheMux.Unlock()
+
+	if len(added) > 0 || len(removed) > 0 {
+		e.logger.Info("updating the currencies", "added", added, "removed", removed)
+	}
+
+	var err error
+	if e.IsRunning() {
+		err = e.updateSubscriptions(added, removed)
+	}
+
+	// The books of the removed currencies are deleted even if the subscriptions can't be updated,
+	// they would never be updated again.
+	for _, currency := range removed {
+		e.cacheMux.Lock()
+		delete(e.orderBookCache, currency)
+		e.cacheMux.Unlock()
+		e.healthState.setBookSynced(currency, false)
+
+		if deleteErr := e.database.DeleteOrderBook(e.name, currency); deleteErr != nil && err == nil {
+			err = deleteErr
+		}
+	}
+
+	return err
+}
 
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
+// updateSubscriptions subscribes the channels of the added currencies and unsubscribes the removed ones.
+func (e *Gateio) updateSubscriptions(added []string, removed []string) error {
+	if e.isChannelEnabled(ChannelOrderBook) {
+		wsPool, _ := e.connections()
+
+		if len(removed) > 0 {
+			if err := wsPool.Unsubscribe(e.convertToGateioCurrencyStrings(removed)...); err != nil {
+				return err
+			}
+		}
 
-	for {
-		select {
-		case <-interruptSignal:
-			_ = e.Stop()
-			return
-		case <-ticker.C:
-			if !e.wsClient.IsReading() || !e.wsClient.IsSending() {
-				_ = e.Stop()
-				return
+		if len(added) > 0 {
+			if err := wsPool.Subscribe(e.convertToGateioCurrencyStrings(added)...); err != nil {
+				return err
 			}
 		}
 	}
+
+	if e.isChannelEnabled(ChannelOrders) {
+		if len(removed) > 0 {
+			if _, err := e.Request(context.Background(), map[string]interface{}{
+				"channel": "spot.orders",
+				"event":   "unsubscribe",
+				"payload": e.convertToGateioCurrencyStrings(removed),
+			}); err != nil {
+				return err
+			}
+		}
+
+		if len(added) > 0 {
+			if _, err := e.Request(context.Background(), map[string]interface{}{
+				"channel": "spot.orders",
+				"event":   "subscribe",
+				"payload": e.convertToGateioCurrencyStrings(added),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(added) > 0 {
+		if err := e.updateFee(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForDisconnecting stops the run once a connection is lost or a message can't be handled,
+// the signals are handled by the owner.
+func (e *Gateio) waitForDisconnecting(wsPool *wsclt.Pool, wsClient *wsclt.Client, failed <-chan struct{}, stopped <-chan struct{}) {
+	select {
+	case <-stopped:
+		return
+	case <-failed:
+	case <-wsPool.Done():
+		e.fail(errors.New("the order book connections are closed"))
+	case <-wsClient.Done():
+		e.fail(fmt.Errorf("the connection is lost: %w", wsClient.Err()))
+	}
+
+	e.runningMux.Lock()
+	defer e.runningMux.Unlock()
+
+	// The run may have been stopped, or even started again, in the meantime.
+	if e.isCurrentRun(stopped) {
+		_ = e.stop()
+	}
+}
+
+// Replay feeds a recording of the connection to the message handler,
+// the speed scales the original intervals between the frames.
+func (e *Gateio) Replay(ctx context.Context, path string, speed float64) error {
+	return (&wsclt.Replayer{Speed: speed, Heartbeat: gateioHeartbeat}).PlayFile(ctx, path, e.handleMessage)
 }
 
 func (e *Gateio) RestApi(option *RestApiOption) ([]byte, error) {
@@ -514,8 +753,8 @@ func (e *Gateio) RestApi(option *RestApiOption) ([]byte, error) {
 	sign := hex.EncodeToString(hash.Sum(nil))
 
 	restApiURL := url.URL{
-		Scheme: GateioRestApiProtocol,
-		Host:   GateioRestApiHost,
+		Scheme: e.restApiURL.Scheme,
+		Host:   e.restApiURL.Host,
 		Path:   GateioRestApiPath,
 	}
 
@@ -531,12 +770,12 @@ func (e *Gateio) RestApi(option *RestApiOption) ([]byte, error) {
 		req.Header.Add("Content-Type", "application/json")
 		req.Header.Add("Accept", "application/json")
 
+		start := time.Now()
 		if resp, err := e.restClient.Do(req); err == nil {
+			e.recordRestRequest(option.path, start, strconv.Itoa(resp.StatusCode))
+
 			defer func(Body io.ReadCloser) {
-				err := Body.Close()
-				if err != nil {
-					panic(err)
-				}
+				_ = Body.Close()
 			}(resp.Body)
 
 			if resp.StatusCode == http.StatusOK ||
@@ -552,6 +791,7 @@ func (e *Gateio) RestApi(option *RestApiOption) ([]byte, error) {
 				return nil, errors.New(resp.Status)
 			}
 		} else {
+			e.recordRestRequest(option.path, start, "error")
 			return nil, err
 		}
 	} else {
@@ -559,83 +799,226 @@ func (e *Gateio) RestApi(option *RestApiOption) ([]byte, error) {
 	}
 }
 
+func (e *Gateio) Ping() error {
+	if e.restClient == nil {
+		if restClient, err := e.newRestClient(); err != nil {
+			return err
+		} else {
+			e.restClient = restClient
+		}
+	}
+
+	_, err := e.RestApi(&RestApiOption{
+		method: "GET",
+		path:   "/wallet/fee",
+	})
+
+	return err
+}
+
 func (e *Gateio) Start() error {
+	e.runningMux.Lock()
 	if e.running {
+		e.runningMux.Unlock()
 		return errors.New("exchange is already running")
-	} else {
-		e.running = true
 	}
 
-	e.restClient = &http.Client{}
+	e.running = true
+	failed, stopped := e.beginRun()
+	e.runningMux.Unlock()
+
+	e.healthState.reset()
+
+	// The updates of the previous run may have been missed, so the order books are fetched again.
+	e.cacheMux.Lock()
+	for _, currency := range e.currencies {
+		e.orderBookCache[currency] = &gateioCacheOrderBook{
+			Id:   0,
+			Data: &database.OrderBook{},
+		}
+	}
+	e.cacheMux.Unlock()
+
+	if err := e.start(failed, stopped); err != nil {
+		_ = e.Stop()
+		return err
+	}
 
-	go e.waitForDisconnecting()
+	return nil
+}
+
+// start opens the connections of the run, subscribes and fetches the fees and the balances.
+func (e *Gateio) start(failed <-chan struct{}, stopped <-chan struct{}) error {
+	if restClient, err := e.newRestClient(); err != nil {
+		return err
+	} else {
+		e.restClient = restClient
+	}
 
 	gateioWebsocketPublicApiURL := url.URL{
-		Scheme: GateioWebsocketApiProtocol,
-		Host:   GateioWebsocketApiHost,
+		Scheme: e.websocketApiURL.Scheme,
+		Host:   e.websocketApiURL.Host,
 		Path:   GateioWebsocketApiPath,
 	}
 
-	e.wsClient = wsclt.NewClient(&wsclt.Options{
-		SkipVerify:     false,
-		PingInterval:   e.aliveSignalInterval,
-		MessageHandler: e.handleMessage,
+	// The order books are sharded across the connections of the pool,
+	// the orders and the balances are subscribed on a single connection.
+	publicRecorder, err := e.newRecorder("public")
+	if err != nil {
+		return err
+	}
+
+	wsPool, err := wsclt.NewPool(&wsclt.PoolOptions{
+		Options: wsclt.Options{
+			SkipVerify:        false,
+			EnableCompression: true,
+			Proxy:             e.proxy,
+			PingInterval:      e.aliveSignalInterval,
+			PongTimeout:       e.pongTimeout,
+			MessageHandler:    e.handleMessage,
+			Recorder:          publicRecorder,
+			Heartbeat:         gateioHeartbeat,
+			Logger:            e.connectionLogger("public"),
+			Metrics:           e.connectionMetrics("public"),
+		},
+		MaxTopicsPerConnection: e.maxSubscriptionsPerConnection,
+		BuildSubscribe:         e.buildOrderBookSubscribe,
+		BuildUnsubscribe:       e.buildOrderBookUnsubscribe,
+	})
+	if err != nil {
+		return err
+	}
+
+	e.connectionsMux.Lock()
+	e.wsPool = wsPool
+	e.connectionsMux.Unlock()
+
+	if err := e.wsPool.Connect(context.Background(), gateioWebsocketPublicApiURL.String()); err != nil {
+		return err
+	}
+
+	privateRecorder, err := e.newRecorder("private")
+	if err != nil {
+		return err
+	}
+
+	wsClient := wsclt.NewClient(&wsclt.Options{
+		SkipVerify:        false,
+		EnableCompression: true,
+		Proxy:             e.proxy,
+		PingInterval:      e.aliveSignalInterval,
+		PongTimeout:       e.pongTimeout,
+		MessageHandler:    e.handleMessage,
+		Recorder:          privateRecorder,
+		Heartbeat:         gateioHeartbeat,
+		Logger:            e.connectionLogger("private"),
+		Metrics:           e.connectionMetrics("private"),
 	})
 
-	if err := e.wsClient.Connect(gateioWebsocketPublicApiURL.String()); err != nil {
+	e.connectionsMux.Lock()
+	e.wsClient = wsClient
+	e.connectionsMux.Unlock()
+
+	if err := e.wsClient.Connect(context.Background(), gateioWebsocketPublicApiURL.String()); err != nil {
 		return err
 	}
 
-	e.subscribe()
+	go e.waitForDisconnecting(wsPool, wsClient, failed, stopped)
 
-	if err := e.updateFee(); err != nil {
+	if err := e.subscribe(); err != nil {
 		return err
 	}
 
-	if err := e.initializeBalance(); err != nil {
+	if err := e.updateFee(); err != nil {
 		return err
 	}
 
+	// Gate.io signs every request instead of logging in, the credentials are accepted once a signed request succeeds.
+	e.healthState.setLoggedIn()
+
+	if e.isChannelEnabled(ChannelBalances) {
+		if err := e.initializeBalance(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Health reports the state of the connections, the credentials, the subscriptions and the order books.
+func (e *Gateio) Health() Health {
+	wsPool, wsClient := e.connections()
+
+	return e.reportHealth(wsPool != nil && wsPool.IsConnected() && wsClient != nil && wsClient.IsConnected())
+}
+
 func (e *Gateio) Stop() error {
+	e.runningMux.Lock()
+	defer e.runningMux.Unlock()
+
+	return e.stop()
+}
+
+// stop closes the connections of the current run, even if it has not fully started,
+// it must be called with runningMux held.
+func (e *Gateio) stop() error {
 	if !e.running {
 		return nil
 	}
 
-	if err := e.wsClient.Close(); err != nil {
-		return err
+	e.endRun()
+
+	var firstErr error
+
+	if e.wsPool != nil {
+		firstErr = e.wsPool.Close()
+	}
+
+	if e.wsClient != nil {
+		if err := e.wsClient.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := e.closeRecorders(); err != nil && firstErr == nil {
+		firstErr = err
 	}
 
 	e.running = false
-	return nil
+	return firstErr
 }
 
-func NewGateio(config map[string]string, currencies []string, interactor *database.Interactor) *Gateio {
+// NewGateio creates the Gate.io exchange, the credentials are required and the other settings are optional.
+func NewGateio(settings *Settings, currencies []string, interactor *database.Interactor) (*Gateio, error) {
 	gateio := &Gateio{
 		Exchange: Exchange{
-			name:                "gateio",
-			database:            interactor,
-			running:             false,
-			aliveSignalInterval: 25 * time.Second,
-			currencies:          currencies,
+			name:        "gateio",
+			database:    interactor,
+			running:     false,
+			pongTimeout: 10 * time.Second,
+			currencies:  currencies,
+			logger:      slog.Default().With(logging.KeyExchange, "gateio"),
 		},
 
 		messages: make(chan []byte, 100),
 	}
 
-	if apiKey, ok := config["apiKey"]; ok {
-		gateio.authData.ApiKey = apiKey
-	} else {
-		panic("No API key provided for Gateio")
+	if err := gateio.configure(settings,
+		url.URL{Scheme: GateioWebsocketApiProtocol, Host: GateioWebsocketApiHost},
+		url.URL{Scheme: GateioRestApiProtocol, Host: GateioRestApiHost},
+	); err != nil {
+		return nil, fmt.Errorf("invalid settings of Gate.io: %w", err)
 	}
 
-	if apiSecret, ok := config["secret"]; ok {
-		gateio.authData.ApiSecret = apiSecret
-	} else {
-		panic("No API secret provided for Gateio")
+	if settings.ApiKey == "" {
+		return nil, errors.New("no API key provided for Gate.io")
+	}
+	gateio.authData.ApiKey = settings.ApiKey
+
+	if settings.Secret == "" {
+		return nil, errors.New("no API secret provided for Gate.io")
 	}
+	gateio.authData.ApiSecret = settings.Secret
 
 	gateio.orderBookCache = make(map[string]*gateioCacheOrderBook)
 
@@ -646,5 +1029,5 @@ func NewGateio(config map[string]string, currencies []string, interactor *databa
 		}
 	}
 
-	return gateio
+	return gateio, nil
 }
@@ -1,37 +1,74 @@
 package exchange
 
 import (
+	"context"
 	"encoding/json"
-	"os"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	"markets/pkg/database"
+	"markets/pkg/exchange/exchangetest"
+	"markets/pkg/metrics"
+	"markets/pkg/wsclt"
 )
 
 func TestGateio(t *testing.T) {
-	e := NewGateio(
-		map[string]string{
-			"apiKey": os.Getenv("TEST_GATEIO_API_KEY"),
-			"secret": os.Getenv("TEST_GATEIO_SECRET"),
+	server := exchangetest.NewGateioServer()
+	defer server.Close()
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewGateio(
+		&Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
 		},
 		[]string{"BTC/USDT"},
-		database.NewInteractor(database.NewInternalConnector()),
+		interactor,
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	if e.authData.ApiKey != os.Getenv("TEST_GATEIO_API_KEY") {
-		t.Errorf("API Key is not set correctly.\nExpected:\n\t%s\nActual:\n\t%s",
-			os.Getenv("TEST_GATEIO_API_KEY"), e.authData.ApiKey)
+	if e.authData.ApiKey != "key" || e.authData.ApiSecret != "secret" {
+		t.Errorf("Auth data is not set correctly: %v", e.authData)
 	}
 
-	if e.authData.ApiSecret != os.Getenv("TEST_GATEIO_SECRET") {
-		t.Errorf("API Secret is not set correctly.\nExpected:\n\t%s\nActual:\n\t%s",
-			os.Getenv("TEST_GATEIO_SECRET"), e.authData.ApiSecret)
+	exchangeMetrics := NewMetrics(metrics.NewRegistry())
+	e.SetMetrics(exchangeMetrics)
+
+	if err := e.Ping(); err != nil {
+		t.Error("Can't ping gateio:", err)
 	}
 
 	if err := e.Start(); err != nil {
-		t.Error("Can't start gateio:", err)
+		t.Fatal("Can't start gateio:", err)
 	}
 
+	expected := database.OrderBook{
+		Asks: map[string]string{"20002": "2"},
+		Bids: map[string]string{"19999": "3", "19998": "4"},
+	}
+
+	waitFor(t, "the order book", func() bool {
+		orderBook, err := interactor.GetOrderBook("gateio", "BTC/USDT")
+		return err == nil && reflect.DeepEqual(*orderBook, expected)
+	})
+
+	waitFor(t, "the balances", func() bool {
+		usdt, usdtErr := interactor.GetBalance("gateio", "USDT")
+		btc, btcErr := interactor.GetBalance("gateio", "BTC")
+		return usdtErr == nil && btcErr == nil && usdt.Total == 15 && btc.Total == 1.5
+	})
+
 	if dataBytes, err := e.RestApi(&RestApiOption{
 		method: "GET",
 		path:   "/wallet/fee",
@@ -48,7 +85,170 @@ func TestGateio(t *testing.T) {
 		}
 	}
 
+	waitFor(t, "the readiness", func() bool {
+		health := e.Health()
+		return health.Ready()
+	})
+
+	if health := e.Health(); fmt.Sprint(health.Channels) != "[spot.balances spot.order_book_update spot.orders]" || !health.OrderBooks["BTC/USDT"] ||
+		time.Since(health.LastMessage) > 5*time.Second {
+		t.Errorf("Health Error: unexpected health %+v", health)
+	}
+
+	// The first update is ahead of the empty order book, so it is fetched from the rest api.
+	if exchangeMetrics.Updates.With("gateio", "spot.order_book_update").Value() == 0 ||
+		exchangeMetrics.Updates.With("gateio", "spot.balances").Value() == 0 ||
+		exchangeMetrics.Resyncs.With("gateio", "BTC/USDT").Value() == 0 ||
+		exchangeMetrics.RestRequests.With("gateio", "/spot/order_book", "200").Value() == 0 ||
+		exchangeMetrics.RestDuration.With("gateio", "/wallet/fee").Count() == 0 ||
+		exchangeMetrics.WebsocketMessages.With("gateio", "public", "in").Value() == 0 ||
+		exchangeMetrics.WebsocketBytes.With("gateio", "private", "out").Value() == 0 {
+		t.Error("Metrics Error: the activity of gateio is not counted")
+	}
+
 	if err := e.Stop(); err != nil {
 		t.Error("Can't stop okx", err)
 	}
+
+	if health := e.Health(); health.Running || health.Connected || health.Ready() {
+		t.Errorf("Health Error: expected the stopped exchange not to be ready, got %+v", health)
+	}
+}
+
+func TestGateio_UpdateCurrencies(t *testing.T) {
+	server := exchangetest.NewGateioServer()
+	defer server.Close()
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewGateio(
+		&Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
+		},
+		[]string{"BTC/USDT"},
+		interactor,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Start(); err != nil {
+		t.Fatal("Can't start gateio:", err)
+	}
+	defer e.Stop()
+
+	waitFor(t, "the order book of BTC/USDT", func() bool {
+		_, err := interactor.GetOrderBook("gateio", "BTC/USDT")
+		return err == nil
+	})
+
+	connections := server.Connections()
+
+	if err := e.UpdateCurrencies([]string{"ETH/USDT"}); err != nil {
+		t.Fatal("Can't update the currencies:", err)
+	}
+
+	waitFor(t, "the order book of ETH/USDT", func() bool {
+		_, err := interactor.GetOrderBook("gateio", "ETH/USDT")
+		return err == nil
+	})
+
+	if _, err := interactor.GetOrderBook("gateio", "BTC/USDT"); err == nil {
+		t.Error("The order book of the removed currency should be deleted")
+	}
+
+	if server.Connections() != connections {
+		t.Errorf("The connections should be kept: expected %d, got %d", connections, server.Connections())
+	}
+
+	unsubscribed := false
+	for _, message := range server.Received() {
+		if strings.Contains(message, `"unsubscribe"`) && strings.Contains(message, "BTC_USDT") {
+			unsubscribed = true
+		}
+	}
+
+	if !unsubscribed {
+		t.Error("The removed currency is not unsubscribed")
+	}
+}
+
+func TestGateio_UpdateCurrenciesError(t *testing.T) {
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewGateio(&Settings{ApiKey: "key", Secret: "secret"}, []string{"BTC/USDT", "ETH/USDT"}, interactor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := interactor.SetOrderBook("gateio", "ETH/USDT", &database.OrderBook{Asks: map[string]string{"1": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pool is not connected, so the removed currency can't be unsubscribed.
+	if e.wsPool, err = wsclt.NewPool(&wsclt.PoolOptions{
+		MaxTopicsPerConnection: 1,
+		BuildSubscribe:         e.buildOrderBookSubscribe,
+		BuildUnsubscribe:       e.buildOrderBookUnsubscribe,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	e.running = true
+
+	if err := e.UpdateCurrencies([]string{"BTC/USDT"}); !errors.Is(err, wsclt.ErrClosed) {
+		t.Errorf("Expected the error of unsubscribing, got %v", err)
+	}
+
+	if _, err := interactor.GetOrderBook("gateio", "ETH/USDT"); err == nil {
+		t.Error("The order book of the removed currency should be deleted even if it can't be unsubscribed")
+	}
+}
+
+func TestGateio_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateio-public.jsonl")
+
+	recorder, err := wsclt.NewFileRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.Record(wsclt.DirectionInbound, websocket.TextMessage, []byte(`{"channel":"spot.order_book_update","event":"update","result":{"s":"BTC_USDT","U":1,"u":2,"a":[["20001","1"]],"b":[["19999","3"]]}}`))
+	recorder.Record(wsclt.DirectionInbound, websocket.TextMessage, []byte(`{"channel":"spot.order_book_update","event":"update","result":{"s":"BTC_USDT","U":3,"u":3,"a":[["20001","0"]],"b":[["19998","4"]]}}`))
+	recorder.Record(wsclt.DirectionInbound, websocket.TextMessage, []byte(`{"channel":"spot.balances","event":"update","result":[{"currency":"USDT","available":"10","total":"15"}]}`))
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewGateio(
+		&Settings{ApiKey: "key", Secret: "secret"},
+		[]string{"BTC/USDT"},
+		interactor,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Replay(context.Background(), path, 0); err != nil {
+		t.Fatal("Can't replay gateio:", err)
+	}
+
+	expected := database.OrderBook{
+		Asks: map[string]string{},
+		Bids: map[string]string{"19999": "3", "19998": "4"},
+	}
+
+	if orderBook, err := interactor.GetOrderBook("gateio", "BTC/USDT"); err != nil {
+		t.Error("Can't get order book:", err)
+	} else if !reflect.DeepEqual(*orderBook, expected) {
+		t.Errorf("Order book is not replayed correctly.\nExpected:\n\t%v\nActual:\n\t%v", expected, *orderBook)
+	}
+
+	if balance, err := interactor.GetBalance("gateio", "USDT"); err != nil {
+		t.Error("Can't get balance:", err)
+	} else if balance.Used != 5 {
+		t.Errorf("Balance is not replayed correctly: %v", balance)
+	}
 }
@@ -0,0 +1,138 @@
+package exchange
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Health is a snapshot of the state of an exchange, e.g. for the probes of an orchestrator.
+type Health struct {
+	Name    string
+	Running bool
+	// Connected is true if all connections of the exchange are alive.
+	Connected bool
+	// LoggedIn is true once the exchange has accepted the credentials.
+	LoggedIn bool
+	// Channels are the channels whose subscriptions have been acknowledged, in order.
+	Channels []string
+	// LastMessage is when the last message was received, it is zero if nothing has been received yet.
+	LastMessage time.Time
+	// OrderBooks tells whether the order book of every currency is synchronized,
+	// it is nil if the order books are not subscribed.
+	OrderBooks map[string]bool
+}
+
+// Ready reports whether the exchange is running, connected, logged in and all order books are synchronized.
+func (h *Health) Ready() bool {
+	if !h.Running || !h.Connected || !h.LoggedIn {
+		return false
+	}
+
+	for _, synced := range h.OrderBooks {
+		if !synced {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HealthReporter is implemented by the exchanges which report their health.
+type HealthReporter interface {
+	Health() Health
+}
+
+// healthState is the part of the health which is tracked while the messages are handled,
+// it is reset by Start.
+type healthState struct {
+	mux         sync.Mutex
+	loggedIn    bool
+	channels    map[string]bool
+	syncedBooks map[string]bool
+
+	lastMessage atomic.Int64
+}
+
+func (s *healthState) reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.loggedIn = false
+	s.channels = make(map[string]bool)
+	s.syncedBooks = make(map[string]bool)
+}
+
+func (s *healthState) received(receivedTime time.Time) {
+	s.lastMessage.Store(receivedTime.UnixNano())
+}
+
+func (s *healthState) setLoggedIn() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.loggedIn = true
+}
+
+func (s *healthState) subscribed(channels ...string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.channels == nil {
+		s.channels = make(map[string]bool)
+	}
+
+	for _, channel := range channels {
+		s.channels[channel] = true
+	}
+}
+
+func (s *healthState) setBookSynced(currency string, synced bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.syncedBooks == nil {
+		s.syncedBooks = make(map[string]bool)
+	}
+
+	if synced {
+		s.syncedBooks[currency] = true
+	} else {
+		delete(s.syncedBooks, currency)
+	}
+}
+
+// reportHealth builds the health of the exchange, the adapters tell whether their connections are alive.
+func (e *Exchange) reportHealth(connected bool) Health {
+	health := Health{
+		Name:      e.name,
+		Running:   e.IsRunning(),
+		Connected: connected,
+	}
+
+	if lastMessage := e.healthState.lastMessage.Load(); lastMessage != 0 {
+		health.LastMessage = time.Unix(0, lastMessage)
+	}
+
+	currencies := e.getCurrencies()
+
+	e.healthState.mux.Lock()
+	defer e.healthState.mux.Unlock()
+
+	health.LoggedIn = e.healthState.loggedIn
+
+	for channel := range e.healthState.channels {
+		health.Channels = append(health.Channels, channel)
+	}
+	sort.Strings(health.Channels)
+
+	if e.isChannelEnabled(ChannelOrderBook) {
+		health.OrderBooks = make(map[string]bool, len(currencies))
+		for _, currency := range currencies {
+			health.OrderBooks[currency] = e.healthState.syncedBooks[currency]
+		}
+	}
+
+	return health
+}
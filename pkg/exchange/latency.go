@@ -0,0 +1,135 @@
+package exchange
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyWindowSize is the number of recent samples kept for every channel.
+const latencyWindowSize = 1024
+
+// LatencyPercentiles summarizes the recent samples of a latency.
+type LatencyPercentiles struct {
+	P50 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// LatencyStats is the latency of a channel.
+// Receive is the time from the exchange timestamp to the message being received,
+// it also includes the clock offset between the exchange and the local host.
+// Store is the time from the message being received to it being stored in the database.
+type LatencyStats struct {
+	Samples int
+	Receive LatencyPercentiles
+	Store   LatencyPercentiles
+}
+
+// latencyWindow is a ring buffer of the recent samples.
+type latencyWindow struct {
+	receive []time.Duration
+	store   []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(receive, store time.Duration) {
+	if len(w.receive) < latencyWindowSize {
+		w.receive = append(w.receive, receive)
+		w.store = append(w.store, store)
+		return
+	}
+
+	w.receive[w.next] = receive
+	w.store[w.next] = store
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// latencyTracker keeps the latencies of every channel of an exchange, the zero value is ready to use.
+type latencyTracker struct {
+	mux      sync.Mutex
+	channels map[string]*latencyWindow
+}
+
+// record adds a sample of the channel, the exchange time is skipped if it is unknown.
+func (t *latencyTracker) record(channel string, exchangeTime, receivedTime, storedTime time.Time) {
+	if exchangeTime.IsZero() {
+		return
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.channels == nil {
+		t.channels = make(map[string]*latencyWindow)
+	}
+
+	window, ok := t.channels[channel]
+	if !ok {
+		window = &latencyWindow{}
+		t.channels[channel] = window
+	}
+
+	window.add(receivedTime.Sub(exchangeTime), storedTime.Sub(receivedTime))
+}
+
+func (t *latencyTracker) stats() map[string]LatencyStats {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	stats := make(map[string]LatencyStats, len(t.channels))
+	for channel, window := range t.channels {
+		stats[channel] = LatencyStats{
+			Samples: len(window.receive),
+			Receive: percentiles(window.receive),
+			Store:   percentiles(window.store),
+		}
+	}
+
+	return stats
+}
+
+// percentiles uses the nearest rank method on a sorted copy of the samples.
+func percentiles(samples []time.Duration) LatencyPercentiles {
+	if len(samples) == 0 {
+		return LatencyPercentiles{}
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(percentile int) time.Duration {
+		index := (len(sorted)*percentile+99)/100 - 1
+		if index < 0 {
+			index = 0
+		}
+		return sorted[index]
+	}
+
+	return LatencyPercentiles{
+		P50: rank(50),
+		P99: rank(99),
+		Max: sorted[len(sorted)-1],
+	}
+}
+
+// parseMillisecondTime parses the millisecond timestamps of the exchanges, e.g. "1597026383085".
+// The zero time is returned if the timestamp is invalid.
+func parseMillisecondTime(value string) time.Time {
+	milliseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return millisecondTime(milliseconds)
+}
+
+// millisecondTime returns the zero time if the timestamp is missing.
+func millisecondTime(milliseconds int64) time.Time {
+	if milliseconds <= 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(milliseconds)
+}
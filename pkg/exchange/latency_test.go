@@ -0,0 +1,47 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	var tracker latencyTracker
+
+	exchangeTime := time.UnixMilli(1597026383085)
+	for i := 1; i <= 100; i++ {
+		receivedTime := exchangeTime.Add(time.Duration(i) * time.Millisecond)
+		tracker.record("books", exchangeTime, receivedTime, receivedTime.Add(time.Duration(i)*time.Microsecond))
+	}
+
+	// The samples without the exchange timestamp are skipped.
+	tracker.record("books", time.Time{}, exchangeTime, exchangeTime)
+
+	stats, ok := tracker.stats()["books"]
+	if !ok {
+		t.Fatal("Latency of books not found")
+	}
+
+	if stats.Samples != 100 {
+		t.Errorf("Expected 100 samples, got %d", stats.Samples)
+	}
+
+	expectedReceive := LatencyPercentiles{P50: 50 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}
+	if stats.Receive != expectedReceive {
+		t.Errorf("Receive latency Error: expected %v, got %v", expectedReceive, stats.Receive)
+	}
+
+	expectedStore := LatencyPercentiles{P50: 50 * time.Microsecond, P99: 99 * time.Microsecond, Max: 100 * time.Microsecond}
+	if stats.Store != expectedStore {
+		t.Errorf("Store latency Error: expected %v, got %v", expectedStore, stats.Store)
+	}
+
+	// The window keeps the most recent samples only.
+	for i := 0; i < latencyWindowSize; i++ {
+		tracker.record("books", exchangeTime, exchangeTime.Add(time.Second), exchangeTime.Add(time.Second))
+	}
+
+	if stats := tracker.stats()["books"]; stats.Samples != latencyWindowSize || stats.Receive.Max != time.Second {
+		t.Errorf("Rolling window Error: got %v", stats)
+	}
+}
@@ -0,0 +1,119 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"markets/pkg/metrics"
+	"markets/pkg/wsclt"
+)
+
+// Metrics counts the activity of the exchanges, it is shared by all exchanges, which are told apart by the exchange label.
+type Metrics struct {
+	Updates      *metrics.CounterVec
+	ParseErrors  *metrics.CounterVec
+	Resyncs      *metrics.CounterVec
+	RestRequests *metrics.CounterVec
+	RestDuration *metrics.HistogramVec
+	Restarts     *metrics.CounterVec
+
+	WebsocketMessages   *metrics.CounterVec
+	WebsocketBytes      *metrics.CounterVec
+	WebsocketReconnects *metrics.CounterVec
+}
+
+// NewMetrics registers the metrics of the exchanges and their connections in the registry.
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		Updates: registry.Counter("markets_exchange_updates_total",
+			"The updates handled, by channel.", "exchange", "channel"),
+		ParseErrors: registry.Counter("markets_exchange_parse_errors_total",
+			"The messages which can't be parsed, by channel.", "exchange", "channel"),
+		Resyncs: registry.Counter("markets_exchange_order_book_resyncs_total",
+			"The order books fetched again after a gap in the updates.", "exchange", "currency"),
+		RestRequests: registry.Counter("markets_exchange_rest_requests_total",
+			"The requests of the rest api, by endpoint and status, the status is error if there is no response.",
+			"exchange", "endpoint", "status"),
+		RestDuration: registry.Histogram("markets_exchange_rest_request_duration_seconds",
+			"The duration of the requests of the rest api.", nil, "exchange", "endpoint"),
+		Restarts: registry.Counter("markets_exchange_restarts_total",
+			"The runs of the exchange which have failed and have been started again by the supervisor.", "exchange"),
+
+		WebsocketMessages: registry.Counter("markets_websocket_messages_total",
+			"The websocket frames, by direction.", "exchange", "connection", "direction"),
+		WebsocketBytes: registry.Counter("markets_websocket_bytes_total",
+			"The payload bytes of the websocket frames, by direction.", "exchange", "connection", "direction"),
+		WebsocketReconnects: registry.Counter("markets_websocket_reconnects_total",
+			"The websocket connections opened again after they were lost.", "exchange", "connection"),
+	}
+}
+
+// SetMetrics counts the activity of the exchange, it is not counted by default.
+// It must be called before Start.
+func (e *Exchange) SetMetrics(m *Metrics) {
+	e.metrics = m
+}
+
+// connectionMetrics returns the counters of the connection, it is nil if the metrics are disabled.
+func (e *Exchange) connectionMetrics(connectionName string) *wsclt.Metrics {
+	if e.metrics == nil {
+		return nil
+	}
+
+	return &wsclt.Metrics{
+		MessagesIn:  e.metrics.WebsocketMessages.With(e.name, connectionName, "in"),
+		BytesIn:     e.metrics.WebsocketBytes.With(e.name, connectionName, "in"),
+		MessagesOut: e.metrics.WebsocketMessages.With(e.name, connectionName, "out"),
+		BytesOut:    e.metrics.WebsocketBytes.With(e.name, connectionName, "out"),
+		Reconnects:  e.metrics.WebsocketReconnects.With(e.name, connectionName),
+	}
+}
+
+// isParseError tells whether the error comes from decoding a message.
+func isParseError(err error) bool {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	return errors.As(err, &syntaxError) || errors.As(err, &typeError)
+}
+
+// recordUpdate counts the update of the channel, the failures to decode it are counted as parse errors.
+func (e *Exchange) recordUpdate(channel string, err error) {
+	if e.metrics == nil {
+		return
+	}
+
+	if err == nil {
+		e.metrics.Updates.With(e.name, channel).Inc()
+	} else if isParseError(err) {
+		e.metrics.ParseErrors.With(e.name, channel).Inc()
+	}
+}
+
+// recordParseError counts a message which can't be decoded before its channel is known.
+func (e *Exchange) recordParseError() {
+	if e.metrics == nil {
+		return
+	}
+
+	e.metrics.ParseErrors.With(e.name, "unknown").Inc()
+}
+
+func (e *Exchange) recordResync(currency string) {
+	if e.metrics == nil {
+		return
+	}
+
+	e.metrics.Resyncs.With(e.name, currency).Inc()
+}
+
+// recordRestRequest counts the request of the endpoint which has started at the time.
+func (e *Exchange) recordRestRequest(endpoint string, start time.Time, status string) {
+	if e.metrics == nil {
+		return
+	}
+
+	e.metrics.RestRequests.With(e.name, endpoint, status).Inc()
+	e.metrics.RestDuration.With(e.name, endpoint).ObserveSince(start)
+}
@@ -1,6 +1,7 @@
 package exchange
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -8,15 +9,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
-	"os/signal"
 	"strconv"
 	"strings"
 	"time"
 
 	"markets/pkg/database"
+	"markets/pkg/logging"
 	"markets/pkg/wsclt"
 )
 
@@ -33,6 +34,9 @@ const (
 	OkxRestApiTimeStampFormat = "2006-01-02T15:04:05.999Z"
 )
 
+// okxHeartbeat sends the plain text ping of OKX, the pong replies are not passed to the handlers.
+var okxHeartbeat = &wsclt.TextHeartbeat{PingText: "ping", PongText: "pong"}
+
 type okxFeeResult struct {
 	Code int `json:"string"`
 	Data []struct {
@@ -48,8 +52,9 @@ type okxOrderBookResult struct {
 	} `json:"arg"`
 	Action string `json:"action"`
 	Data   []struct {
-		Asks [][]string `json:"asks"`
-		Bids [][]string `json:"bids"`
+		Asks      [][]string `json:"asks"`
+		Bids      [][]string `json:"bids"`
+		Timestamp string     `json:"ts"`
 	} `json:"data"`
 }
 
@@ -74,6 +79,14 @@ type okxOrderResult struct {
 	} `json:"data"`
 }
 
+// okxResponse is the common part of the responses of the operations.
+type okxResponse struct {
+	Id      string `json:"id"`
+	Event   string `json:"event"`
+	Code    string `json:"code"`
+	Message string `json:"msg"`
+}
+
 type okxBalanceResult struct {
 	Arg struct {
 		Channel     string `json:"channel"`
@@ -86,6 +99,7 @@ type okxBalanceResult struct {
 			Used     string `json:"frozenBal"`
 			Total    string `json:"eq"`
 		} `json:"details"`
+		UpdateTime string `json:"uTime"`
 	} `json:"data"`
 }
 
@@ -94,13 +108,12 @@ type Okx struct {
 
 	restClient *http.Client
 	wsClients  struct {
-		Public  *wsclt.Client
+		Public  *wsclt.Pool
 		Private *wsclt.Client
 	}
 
 	publicMessages  chan []byte
 	privateMessages chan []byte
-	loginCode       chan int
 
 	authData struct {
 		ApiKey     string
@@ -116,7 +129,7 @@ func (e *Okx) updateFee() error {
 		return errors.New("the rest api client is not ready")
 	}
 
-	for _, currency := range e.currencies {
+	for _, currency := range e.getCurrencies() {
 		okxCurrency := e.convertToOkxCurrencyString(currency)
 		if data, err := e.RestApi(&RestApiOption{
 			method: "GET",
@@ -147,7 +160,7 @@ func (e *Okx) updateFee() error {
 						fee.Taker = value
 					}
 
-					if err := e.database.SetFee(e.name, okxCurrency, &fee); err != nil {
+					if err := e.database.SetFee(e.name, currency, &fee); err != nil {
 						return err
 					}
 				} else {
@@ -160,7 +173,7 @@ func (e *Okx) updateFee() error {
 	return nil
 }
 
-func (e *Okx) updateOrderBook(message []byte) error {
+func (e *Okx) updateOrderBook(message []byte, receivedTime time.Time) error {
 	var result okxOrderBookResult
 	err := json.Unmarshal(message, &result)
 	if err != nil {
@@ -168,19 +181,38 @@ func (e *Okx) updateOrderBook(message []byte) error {
 	}
 
 	currency := e.convertToGeneralCurrencyString(result.Arg.OkxCurrency)
+
+	e.cacheMux.Lock()
+	orderBook, ok := e.orderBookCache[currency]
+	e.cacheMux.Unlock()
+
+	// The messages may still arrive for a while after the currency is unsubscribed.
+	if !ok {
+		return nil
+	}
+
 	fullMode := result.Action == "snapshot"
+	var exchangeTime time.Time
 	for _, data := range result.Data {
-		updateOrderBook(fullMode, e.orderBookCache[currency], data.Asks, data.Bids)
+		updateOrderBook(fullMode, orderBook, data.Asks, data.Bids)
+		exchangeTime = parseMillisecondTime(data.Timestamp)
 	}
 
-	if err := e.database.SetOrderBook(e.name, currency, e.orderBookCache[currency]); err != nil {
+	if err := e.database.SetOrderBook(e.name, currency, orderBook); err != nil {
 		return err
 	}
 
+	// The order book is synchronized once the snapshot is stored.
+	if fullMode {
+		e.healthState.setBookSynced(currency, true)
+	}
+
+	e.latency.record(result.Arg.Channel, exchangeTime, receivedTime, time.Now())
+
 	return nil
 }
 
-func (e *Okx) updateBalance(message []byte) error {
+func (e *Okx) updateBalance(message []byte, receivedTime time.Time) error {
 	var result okxBalanceResult
 	if err := json.Unmarshal(message, &result); err != nil {
 		return err
@@ -197,12 +229,14 @@ func (e *Okx) updateBalance(message []byte) error {
 				return err
 			}
 		}
+
+		e.latency.record(result.Arg.Channel, parseMillisecondTime(data.UpdateTime), receivedTime, time.Now())
 	}
 
 	return nil
 }
 
-func (e *Okx) updateOrder(message []byte) error {
+func (e *Okx) updateOrder(message []byte, receivedTime time.Time) error {
 	var result okxOrderResult
 	if err := json.Unmarshal(message, &result); err != nil {
 		return err
@@ -258,40 +292,79 @@ func (e *Okx) updateOrder(message []byte) error {
 		if err := e.database.SetOrder(e.name, currency, o.Id, order); err != nil {
 			return err
 		}
+
+		e.latency.record(result.Arg.Channel, parseMillisecondTime(o.UpdateTime), receivedTime, time.Now())
 	}
 
 	return nil
 }
 
-func (e *Okx) waitForDisconnecting() {
-	// Handle SIGINT and SIGTERM.
-	interruptSignal := make(chan os.Signal, 1)
-	signal.Notify(interruptSignal, os.Interrupt)
-	defer close(interruptSignal)
-
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-interruptSignal:
-			_ = e.Stop()
-			return
-		case <-ticker.C:
-			if !e.wsClients.Public.IsReading() ||
-				!e.wsClients.Public.IsSending() ||
-				!e.wsClients.Private.IsReading() ||
-				!e.wsClients.Private.IsSending() {
-				_ = e.Stop()
-				return
-			}
-		}
+// waitForDisconnecting stops the run once a connection is lost or a message can't be handled,
+// the signals are handled by the owner.
+func (e *Okx) waitForDisconnecting(public *wsclt.Pool, private *wsclt.Client, failed <-chan struct{}, stopped <-chan struct{}) {
+	select {
+	case <-stopped:
+		return
+	case <-failed:
+	case <-public.Done():
+		e.fail(errors.New("the public connections are closed"))
+	case <-private.Done():
+		e.fail(fmt.Errorf("the private connection is lost: %w", private.Err()))
+	}
+
+	e.runningMux.Lock()
+	defer e.runningMux.Unlock()
+
+	// The run may have been stopped, or even started again, in the meantime.
+	if e.isCurrentRun(stopped) {
+		_ = e.stop()
+	}
+}
+
+// resolveRequest hands the response of a request sent by Request to the caller waiting for it.
+// The responses without the id are matched by their event if matchEvent is set.
+func (e *Okx) resolveRequest(message []byte, matchEvent bool) bool {
+	var response okxResponse
+	if err := json.Unmarshal(message, &response); err != nil {
+		return false
+	}
+
+	var err error
+	if response.Event == "error" || (response.Code != "" && response.Code != "0") {
+		err = &RequestError{Code: response.Code, Message: response.Message}
+	}
+
+	if response.Id != "" {
+		return e.pending.resolve(response.Id, message, err)
 	}
+
+	if !matchEvent {
+		return false
+	}
+
+	// The id may not be echoed by the acknowledgements of the login and the subscriptions,
+	// so they resolve the oldest request of their operation, and an error with a code fails the login.
+	switch response.Event {
+	case "login", "subscribe", "unsubscribe":
+		return e.pending.resolveOp(response.Event, message, err)
+	case "error":
+		return response.Code != "" && e.pending.resolveOp("login", message, err)
+	}
+
+	return false
 }
 
 func (e *Okx) handlePublicMessage(message []byte) {
+	receivedTime := time.Now()
+	e.healthState.received(receivedTime)
+
 	var data map[string]interface{}
 	if err := json.Unmarshal(message, &data); err != nil {
+		e.recordParseError()
+		return
+	}
+
+	if _, ok := data["id"]; ok && e.resolveRequest(message, false) {
 		return
 	}
 
@@ -300,25 +373,24 @@ func (e *Okx) handlePublicMessage(message []byte) {
 		case "subscribe":
 			if argInterface, ok := data["arg"]; ok {
 				arg := argInterface.(map[string]interface{})
-				switch arg["channel"].(string) {
-				case "books50-l2-tbt":
-					fmt.Println("Subscribed to books50-l2-tbt with", arg["instId"].(string))
-				default:
-					fmt.Println("Subscribed to", arg)
-				}
+				channel, _ := arg["channel"].(string)
+				instId, _ := arg["instId"].(string)
+				e.healthState.subscribed(channel)
+				e.logger.Info("subscribed", logging.KeyChannel, channel, logging.KeyCurrency, e.convertToGeneralCurrencyString(instId))
 			}
 		case "error":
-			fmt.Println("Received error message:", data)
+			e.logger.Error("received an error", "code", data["code"], "message", data["msg"])
 		}
 	} else if argInterface, ok := data["arg"]; ok {
 		arg := argInterface.(map[string]interface{})
 		if channel, ok := arg["channel"]; ok {
 			switch channel.(string) {
 			case "books50-l2-tbt":
-				err := e.updateOrderBook(message)
+				err := e.updateOrderBook(message, receivedTime)
+				e.recordUpdate(channel.(string), err)
 				if err != nil {
-					fmt.Println(err)
-					return
+					// The state can't be trusted after a failed update, so the run is started again.
+					e.fail(fmt.Errorf("can't update the order book: %w", err))
 				}
 			}
 		}
@@ -326,52 +398,50 @@ func (e *Okx) handlePublicMessage(message []byte) {
 }
 
 func (e *Okx) handlePrivateMessage(message []byte) {
+	receivedTime := time.Now()
+	e.healthState.received(receivedTime)
+
 	var data map[string]interface{}
 	if err := json.Unmarshal(message, &data); err != nil {
+		e.recordParseError()
+		return
+	}
+
+	// Only the requests are sent on the private connection, so its acknowledgements without the id belong to them.
+	if e.resolveRequest(message, true) {
 		return
 	}
 
 	if event, ok := data["event"]; ok {
 		switch event {
 		case "login":
-			if codeString, ok := data["code"]; ok {
-				if code, err := strconv.Atoi(codeString.(string)); err == nil {
-					select {
-					case e.loginCode <- code:
-					default:
-						fmt.Println("already logged in")
-					}
-				} else {
-					fmt.Println("login code conversion error:", err)
-				}
-			}
+			e.logger.Debug("received a login message", "code", data["code"])
 		case "subscribe":
 			if argInterface, ok := data["arg"]; ok {
 				arg := argInterface.(map[string]interface{})
-				switch arg["channel"].(string) {
-				case "account":
-					fmt.Println("Subscribed to", arg)
-				case "orders":
-					fmt.Println("Subscribed to", arg)
-				default:
-					fmt.Println("Subscribed to", arg)
-				}
+				channel, _ := arg["channel"].(string)
+				e.healthState.subscribed(channel)
+				e.logger.Info("subscribed", logging.KeyChannel, channel)
 			}
 		case "error":
-			fmt.Println("Received error message:", data)
+			e.logger.Error("received an error", "code", data["code"], "message", data["msg"])
 		}
 	} else if argInterface, ok := data["arg"]; ok {
 		arg := argInterface.(map[string]interface{})
 		if channel, ok := arg["channel"]; ok {
 			switch channel.(string) {
 			case "account":
-				if err := e.updateBalance(message); err != nil {
-					fmt.Println(err)
+				err := e.updateBalance(message, receivedTime)
+				e.recordUpdate(channel.(string), err)
+				if err != nil {
+					e.logger.Error("can't update the balances", logging.KeyChannel, channel, "error", err)
 					return
 				}
 			case "orders":
-				if err := e.updateOrder(message); err != nil {
-					fmt.Println(err)
+				err := e.updateOrder(message, receivedTime)
+				e.recordUpdate(channel.(string), err)
+				if err != nil {
+					e.logger.Error("can't update the orders", logging.KeyChannel, channel, "error", err)
 					return
 				}
 			}
@@ -387,54 +457,195 @@ func (e *Okx) convertToOkxCurrencyString(generalCurrencyString string) string {
 	return strings.Replace(generalCurrencyString, "/", "-", -1)
 }
 
-func (e *Okx) subscribe() {
+// buildPublicMessage builds the message of the operation on the order books of the okx currencies on a public connection.
+func (e *Okx) buildPublicMessage(op string, okxCurrencies []string) ([][]byte, error) {
 	var args []interface{}
 
-	for _, currency := range e.currencies {
-		okxCurrency := e.convertToOkxCurrencyString(currency)
+	for _, okxCurrency := range okxCurrencies {
 		args = append(args, map[string]interface{}{
 			"channel": "books50-l2-tbt",
 			"instId":  okxCurrency,
 		})
 	}
 
-	if err := e.SendPublicMessageJSON(map[string]interface{}{
-		"op":   "subscribe",
+	if dataBytes, err := json.Marshal(map[string]interface{}{
+		"op":   op,
 		"args": args,
 	}); err != nil {
-		panic(err)
+		return nil, err
+	} else {
+		return [][]byte{dataBytes}, nil
 	}
+}
 
-	args = make([]interface{}, 0)
+// buildPublicSubscribe builds the message subscribing the order books of the okx currencies on a public connection.
+func (e *Okx) buildPublicSubscribe(okxCurrencies []string) ([][]byte, error) {
+	return e.buildPublicMessage("subscribe", okxCurrencies)
+}
 
-	args = append(args, map[string]interface{}{
-		"channel": "account",
-	})
+// buildPublicUnsubscribe builds the message unsubscribing the order books of the okx currencies on a public connection.
+func (e *Okx) buildPublicUnsubscribe(okxCurrencies []string) ([][]byte, error) {
+	return e.buildPublicMessage("unsubscribe", okxCurrencies)
+}
 
-	for _, currency := range e.currencies {
-		okxCurrency := e.convertToOkxCurrencyString(currency)
+// ordersArgs returns the arguments of the orders channel of the currencies.
+func (e *Okx) ordersArgs(currencies []string) []interface{} {
+	args := make([]interface{}, 0, len(currencies))
+
+	for _, currency := range currencies {
 		args = append(args, map[string]interface{}{
 			"channel":  "orders",
 			"instType": "SPOT",
-			"instId":   okxCurrency,
+			"instId":   e.convertToOkxCurrencyString(currency),
+		})
+	}
+
+	return args
+}
+
+func (e *Okx) subscribe() error {
+	var okxCurrencies []string
+
+	currencies := e.getCurrencies()
+	for _, currency := range currencies {
+		okxCurrencies = append(okxCurrencies, e.convertToOkxCurrencyString(currency))
+	}
+
+	if e.isChannelEnabled(ChannelOrderBook) {
+		if err := e.wsClients.Public.Subscribe(okxCurrencies...); err != nil {
+			return err
+		}
+	}
+
+	args := make([]interface{}, 0)
+	var channels []string
+
+	if e.isChannelEnabled(ChannelBalances) {
+		args = append(args, map[string]interface{}{
+			"channel": "account",
 		})
+		channels = append(channels, "account")
+	}
+
+	if e.isChannelEnabled(ChannelOrders) {
+		args = append(args, e.ordersArgs(currencies)...)
+		channels = append(channels, "orders")
+	}
+
+	if len(args) == 0 {
+		return nil
 	}
 
-	if err := e.SendPrivateMessageJSON(map[string]interface{}{
+	// The private channels are subscribed by a single request, they are regarded as subscribed once it is acknowledged.
+	if _, err := e.Request(context.Background(), map[string]interface{}{
 		"op":   "subscribe",
 		"args": args,
 	}); err != nil {
-		panic(err)
+		return err
+	} else {
+		e.healthState.subscribed(channels...)
+	}
+
+	return nil
+}
+
+// UpdateCurrencies subscribes the added currencies and unsubscribes the removed ones without reconnecting,
+// the order books of the removed currencies are dropped from the cache and the database.
+func (e *Okx) UpdateCurrencies(currencies []string) error {
+	e.cacheMux.Lock()
+	added, removed := e.replaceCurrencies(currencies)
+	for _, currency := range added {
+		e.orderBookCache[currency] = &database.OrderBook{}
+	}
+	e.cacheMux.Unlock()
+
+	if len(added) > 0 || len(removed) > 0 {
+		e.logger.Info("updating the currencies", "added", added, "removed", removed)
+	}
+
+	var err error
+	if e.IsRunning() {
+		err = e.updateSubscriptions(added, removed)
+	}
+
+	// The books of the removed currencies are deleted even if the subscriptions can't be updated,
+	// they would never be updated again.
+	for _, currency := range removed {
+		e.cacheMux.Lock()
+		delete(e.orderBookCache, currency)
+		e.cacheMux.Unlock()
+		e.healthState.setBookSynced(currency, false)
+
+		if deleteErr := e.database.DeleteOrderBook(e.name, currency); deleteErr != nil && err == nil {
+			err = deleteErr
+		}
 	}
+
+	return err
 }
 
-func (e *Okx) login() {
+// updateSubscriptions subscribes the channels of the added currencies and unsubscribes the removed ones.
+func (e *Okx) updateSubscriptions(added []string, removed []string) error {
+	var addedOkxCurrencies, removedOkxCurrencies []string
+	for _, currency := range added {
+		addedOkxCurrencies = append(addedOkxCurrencies, e.convertToOkxCurrencyString(currency))
+	}
+	for _, currency := range removed {
+		removedOkxCurrencies = append(removedOkxCurrencies, e.convertToOkxCurrencyString(currency))
+	}
+
+	if e.isChannelEnabled(ChannelOrderBook) {
+		public, _ := e.connections()
+
+		if len(removedOkxCurrencies) > 0 {
+			if err := public.Unsubscribe(removedOkxCurrencies...); err != nil {
+				return err
+			}
+		}
+
+		if len(addedOkxCurrencies) > 0 {
+			if err := public.Subscribe(addedOkxCurrencies...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.isChannelEnabled(ChannelOrders) {
+		if len(removed) > 0 {
+			if _, err := e.Request(context.Background(), map[string]interface{}{
+				"op":   "unsubscribe",
+				"args": e.ordersArgs(removed),
+			}); err != nil {
+				return err
+			}
+		}
+
+		if len(added) > 0 {
+			if _, err := e.Request(context.Background(), map[string]interface{}{
+				"op":   "subscribe",
+				"args": e.ordersArgs(added),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(added) > 0 {
+		if err := e.updateFee(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Okx) login() error {
 	epochTime := fmt.Sprint(time.Now().UTC().Unix())
 	hash := hmac.New(sha256.New, []byte(e.authData.ApiSecret))
 	hash.Write([]byte(epochTime + "GET" + OkxWebsocketPrivateApiVerifyPath))
 	sign := base64.StdEncoding.EncodeToString(hash.Sum(nil))
 
-	if err := e.SendPrivateMessageJSON(map[string]interface{}{
+	if _, err := e.Request(context.Background(), map[string]interface{}{
 		"op": "login",
 		"args": []map[string]interface{}{
 			{
@@ -445,18 +656,29 @@ func (e *Okx) login() {
 			},
 		},
 	}); err != nil {
-		panic(err)
-	}
-
-	if code := <-e.loginCode; code != 0 {
-		panic(errors.New("login failed"))
+		return fmt.Errorf("login failed: %w", err)
 	} else {
-		close(e.loginCode)
-		fmt.Println("login!")
+		e.healthState.setLoggedIn()
+		e.logger.Info("logged in")
 	}
+
+	return nil
+}
+
+// Request sends the operation, e.g. login, subscribe or order, on the private connection and
+// waits for the response with the same id, the acknowledgements of the login and the subscriptions
+// are also matched by their operation. The response is returned as it is, a RequestError is
+// returned if the exchange reports an error, and the context error if it times out.
+func (e *Okx) Request(ctx context.Context, payload map[string]interface{}) ([]byte, error) {
+	op, _ := payload["op"].(string)
+
+	return e.requestOp(ctx, op, func(id uint64) error {
+		payload["id"] = strconv.FormatUint(id, 10)
+		return e.SendPrivateMessageJSON(payload)
+	})
 }
 
-func (e *Okx) sendMessageRawBytes(clt *wsclt.Client, dataBytes []byte) error {
+func (e *Okx) sendMessageRawBytes(clt messageSender, dataBytes []byte) error {
 	if err := clt.SendMessage(dataBytes); err != nil {
 		return err
 	} else {
@@ -464,7 +686,7 @@ func (e *Okx) sendMessageRawBytes(clt *wsclt.Client, dataBytes []byte) error {
 	}
 }
 
-func (e *Okx) sendMessageJSON(clt *wsclt.Client, data map[string]interface{}) error {
+func (e *Okx) sendMessageJSON(clt messageSender, data map[string]interface{}) error {
 	if dataBytes, err := json.Marshal(data); err != nil {
 		return err
 	} else {
@@ -472,20 +694,43 @@ func (e *Okx) sendMessageJSON(clt *wsclt.Client, data map[string]interface{}) er
 	}
 }
 
+// connections returns the connections opened by the last Start, which may replace them at any time.
+func (e *Okx) connections() (*wsclt.Pool, *wsclt.Client) {
+	e.connectionsMux.Lock()
+	defer e.connectionsMux.Unlock()
+
+	return e.wsClients.Public, e.wsClients.Private
+}
+
 func (e *Okx) SendPublicMessageRawBytes(dataBytes []byte) error {
-	return e.sendMessageRawBytes(e.wsClients.Public, dataBytes)
+	public, _ := e.connections()
+	return e.sendMessageRawBytes(public, dataBytes)
 }
 
 func (e *Okx) SendPrivateMessageRawBytes(dataBytes []byte) error {
-	return e.sendMessageRawBytes(e.wsClients.Private, dataBytes)
+	_, private := e.connections()
+	return e.sendMessageRawBytes(private, dataBytes)
 }
 
 func (e *Okx) SendPublicMessageJSON(data map[string]interface{}) error {
-	return e.sendMessageJSON(e.wsClients.Public, data)
+	public, _ := e.connections()
+	return e.sendMessageJSON(public, data)
 }
 
 func (e *Okx) SendPrivateMessageJSON(data map[string]interface{}) error {
-	return e.sendMessageJSON(e.wsClients.Private, data)
+	_, private := e.connections()
+	return e.sendMessageJSON(private, data)
+}
+
+// ReplayPublic feeds a recording of the public connection to the message handler,
+// the speed scales the original intervals between the frames.
+func (e *Okx) ReplayPublic(ctx context.Context, path string, speed float64) error {
+	return (&wsclt.Replayer{Speed: speed, Heartbeat: okxHeartbeat}).PlayFile(ctx, path, e.handlePublicMessage)
+}
+
+// ReplayPrivate feeds a recording of the private connection to the message handler.
+func (e *Okx) ReplayPrivate(ctx context.Context, path string, speed float64) error {
+	return (&wsclt.Replayer{Speed: speed, Heartbeat: okxHeartbeat}).PlayFile(ctx, path, e.handlePrivateMessage)
 }
 
 func (e *Okx) RestApi(option *RestApiOption) ([]byte, error) {
@@ -515,8 +760,8 @@ func (e *Okx) RestApi(option *RestApiOption) ([]byte, error) {
 	sign := base64.StdEncoding.EncodeToString(hash.Sum(nil))
 
 	restApiURL := url.URL{
-		Scheme: OkxRestApiProtocol,
-		Host:   OkxRestApiHost,
+		Scheme: e.restApiURL.Scheme,
+		Host:   e.restApiURL.Host,
 		Path:   OkxRestApiPath,
 	}
 
@@ -529,11 +774,12 @@ func (e *Okx) RestApi(option *RestApiOption) ([]byte, error) {
 		req.Header.Add("OK-ACCESS-PASSPHRASE", e.authData.Passphrase)
 		req.Header.Add("Content-Type", "application/json")
 
+		start := time.Now()
 		if resp, err := e.restClient.Do(req); err == nil {
+			e.recordRestRequest(option.path, start, strconv.Itoa(resp.StatusCode))
+
 			defer func(Body io.ReadCloser) {
-				if err := Body.Close(); err != nil {
-					panic(err)
-				}
+				_ = Body.Close()
 			}(resp.Body)
 
 			if resp.StatusCode == http.StatusOK ||
@@ -549,6 +795,7 @@ func (e *Okx) RestApi(option *RestApiOption) ([]byte, error) {
 				return nil, errors.New(resp.Status)
 			}
 		} else {
+			e.recordRestRequest(option.path, start, "error")
 			return nil, err
 		}
 	} else {
@@ -556,51 +803,143 @@ func (e *Okx) RestApi(option *RestApiOption) ([]byte, error) {
 	}
 }
 
+func (e *Okx) Ping() error {
+	if e.restClient == nil {
+		if restClient, err := e.newRestClient(); err != nil {
+			return err
+		} else {
+			e.restClient = restClient
+		}
+	}
+
+	if data, err := e.RestApi(&RestApiOption{
+		method: "GET",
+		path:   "/account/config",
+	}); err != nil {
+		return err
+	} else {
+		// The errors of the requests may be reported with the status 200.
+		var result okxResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			return err
+		} else if result.Code != "0" {
+			return &RequestError{Code: result.Code, Message: result.Message}
+		}
+	}
+
+	return nil
+}
+
 func (e *Okx) Start() error {
+	e.runningMux.Lock()
 	if e.running {
+		e.runningMux.Unlock()
 		return errors.New("exchange is already running")
-	} else {
-		e.running = true
 	}
 
-	go e.waitForDisconnecting()
+	e.running = true
+	failed, stopped := e.beginRun()
+	e.runningMux.Unlock()
 
+	e.healthState.reset()
+
+	if err := e.start(failed, stopped); err != nil {
+		_ = e.Stop()
+		return err
+	}
+
+	return nil
+}
+
+// start opens the connections of the run, logs in and subscribes.
+func (e *Okx) start(failed <-chan struct{}, stopped <-chan struct{}) error {
 	okxWebsocketPublicApiURL := url.URL{
-		Scheme: OkxWebsocketApiProtocol,
-		Host:   OkxWebsocketApiHost,
+		Scheme: e.websocketApiURL.Scheme,
+		Host:   e.websocketApiURL.Host,
 		Path:   OkxWebsocketPublicApiPath,
 	}
 
-	e.wsClients.Public = wsclt.NewClient(&wsclt.Options{
-		SkipVerify:     false,
-		PingInterval:   e.aliveSignalInterval,
-		MessageHandler: e.handlePublicMessage,
+	publicRecorder, err := e.newRecorder("public")
+	if err != nil {
+		return err
+	}
+
+	publicPool, err := wsclt.NewPool(&wsclt.PoolOptions{
+		Options: wsclt.Options{
+			SkipVerify:        false,
+			EnableCompression: true,
+			Proxy:             e.proxy,
+			PingInterval:      e.aliveSignalInterval,
+			PongTimeout:       e.pongTimeout,
+			Heartbeat:         okxHeartbeat,
+			MessageHandler:    e.handlePublicMessage,
+			Recorder:          publicRecorder,
+			Logger:            e.connectionLogger("public"),
+			Metrics:           e.connectionMetrics("public"),
+		},
+		MaxTopicsPerConnection: e.maxSubscriptionsPerConnection,
+		BuildSubscribe:         e.buildPublicSubscribe,
+		BuildUnsubscribe:       e.buildPublicUnsubscribe,
 	})
+	if err != nil {
+		return err
+	}
 
-	if err := e.wsClients.Public.Connect(okxWebsocketPublicApiURL.String()); err != nil {
+	e.connectionsMux.Lock()
+	e.wsClients.Public = publicPool
+	e.connectionsMux.Unlock()
+
+	if err := e.wsClients.Public.Connect(context.Background(), okxWebsocketPublicApiURL.String()); err != nil {
 		return err
 	}
 
 	okxWebsocketPrivateApiURL := url.URL{
-		Scheme: OkxWebsocketApiProtocol,
-		Host:   OkxWebsocketApiHost,
+		Scheme: e.websocketApiURL.Scheme,
+		Host:   e.websocketApiURL.Host,
 		Path:   OkxWebsocketPrivateApiPath,
 	}
 
-	e.wsClients.Private = wsclt.NewClient(&wsclt.Options{
-		SkipVerify:     false,
-		PingInterval:   e.aliveSignalInterval,
-		MessageHandler: e.handlePrivateMessage,
+	privateRecorder, err := e.newRecorder("private")
+	if err != nil {
+		return err
+	}
+
+	privateClient := wsclt.NewClient(&wsclt.Options{
+		SkipVerify:        false,
+		EnableCompression: true,
+		Proxy:             e.proxy,
+		PingInterval:      e.aliveSignalInterval,
+		PongTimeout:       e.pongTimeout,
+		Heartbeat:         okxHeartbeat,
+		MessageHandler:    e.handlePrivateMessage,
+		Recorder:          privateRecorder,
+		Logger:            e.connectionLogger("private"),
+		Metrics:           e.connectionMetrics("private"),
 	})
 
-	if err := e.wsClients.Private.Connect(okxWebsocketPrivateApiURL.String()); err != nil {
+	e.connectionsMux.Lock()
+	e.wsClients.Private = privateClient
+	e.connectionsMux.Unlock()
+
+	if err := e.wsClients.Private.Connect(context.Background(), okxWebsocketPrivateApiURL.String()); err != nil {
 		return err
 	}
 
-	e.login()
-	e.subscribe()
+	go e.waitForDisconnecting(publicPool, privateClient, failed, stopped)
 
-	e.restClient = &http.Client{}
+	if err := e.login(); err != nil {
+		return err
+	}
+
+	if err := e.subscribe(); err != nil {
+		return err
+	}
+
+	if restClient, err := e.newRestClient(); err != nil {
+		return err
+	} else {
+		e.restClient = restClient
+	}
 
 	if err := e.updateFee(); err != nil {
 		return err
@@ -609,60 +948,91 @@ func (e *Okx) Start() error {
 	return nil
 }
 
+// Health reports the state of the connections, the login, the subscriptions and the order books.
+func (e *Okx) Health() Health {
+	public, private := e.connections()
+
+	return e.reportHealth(public != nil && public.IsConnected() && private != nil && private.IsConnected())
+}
+
 func (e *Okx) Stop() error {
+	e.runningMux.Lock()
+	defer e.runningMux.Unlock()
+
+	return e.stop()
+}
+
+// stop closes the connections of the current run, even if it has not fully started,
+// it must be called with runningMux held.
+func (e *Okx) stop() error {
 	if !e.running {
 		return nil
 	}
 
-	if err := e.wsClients.Public.Close(); err != nil {
-		return err
+	e.endRun()
+
+	var firstErr error
+
+	if e.wsClients.Public != nil {
+		firstErr = e.wsClients.Public.Close()
 	}
 
-	if err := e.wsClients.Private.Close(); err != nil {
-		return err
+	if e.wsClients.Private != nil {
+		if err := e.wsClients.Private.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := e.closeRecorders(); err != nil && firstErr == nil {
+		firstErr = err
 	}
 
 	e.running = false
-	return nil
+	return firstErr
 }
 
-func NewOkx(config map[string]string, currencies []string, interactor *database.Interactor) *Okx {
+// NewOkx creates the OKX exchange, the credentials are required and the other settings are optional.
+func NewOkx(settings *Settings, currencies []string, interactor *database.Interactor) (*Okx, error) {
 	okx := &Okx{
 		Exchange: Exchange{
-			name:                "okx",
-			database:            interactor,
-			running:             false,
-			aliveSignalInterval: 25 * time.Second,
-			currencies:          currencies,
+			name:        "okx",
+			database:    interactor,
+			running:     false,
+			pongTimeout: 10 * time.Second,
+			currencies:  currencies,
+			logger:      slog.Default().With(logging.KeyExchange, "okx"),
 		},
 
 		publicMessages:  make(chan []byte),
 		privateMessages: make(chan []byte),
-		loginCode:       make(chan int),
 	}
 
-	if apiKey, ok := config["apiKey"]; ok {
-		okx.authData.ApiKey = apiKey
-	} else {
-		panic("No API key provided for OKX")
+	if err := okx.configure(settings,
+		url.URL{Scheme: OkxWebsocketApiProtocol, Host: OkxWebsocketApiHost},
+		url.URL{Scheme: OkxRestApiProtocol, Host: OkxRestApiHost},
+	); err != nil {
+		return nil, fmt.Errorf("invalid settings of OKX: %w", err)
 	}
 
-	if apiSecret, ok := config["secret"]; ok {
-		okx.authData.ApiSecret = apiSecret
-	} else {
-		panic("No API secret provided for OKX")
+	if settings.ApiKey == "" {
+		return nil, errors.New("no API key provided for OKX")
 	}
+	okx.authData.ApiKey = settings.ApiKey
 
-	if passphrase, ok := config["password"]; ok {
-		okx.authData.Passphrase = passphrase
-	} else {
-		panic("No API Passphrase provided for OKX")
+	if settings.Secret == "" {
+		return nil, errors.New("no API secret provided for OKX")
+	}
+	okx.authData.ApiSecret = settings.Secret
+
+	if settings.Password == "" {
+		return nil, errors.New("no API passphrase provided for OKX")
 	}
+	okx.authData.Passphrase = settings.Password
 
 	okx.orderBookCache = make(map[string]*database.OrderBook)
 	for _, currency := range currencies {
 		okx.orderBookCache[currency] = &database.OrderBook{}
 	}
 
-	return okx
+	return okx, nil
 }
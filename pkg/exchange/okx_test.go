@@ -1,59 +1,367 @@
 package exchange
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	"markets/pkg/database"
+	"markets/pkg/exchange/exchangetest"
+	"markets/pkg/metrics"
+	"markets/pkg/wsclt"
 )
 
 func TestOkx(t *testing.T) {
-	e := NewOkx(
-		map[string]string{
-			"apiKey":   os.Getenv("TEST_OKX_API_KEY"),
-			"secret":   os.Getenv("TEST_OKX_SECRET"),
-			"password": os.Getenv("TEST_OKX_PASSPHASE"),
+	server := exchangetest.NewOkxServer()
+	defer server.Close()
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewOkx(
+		&Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			Password:        "passphrase",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
 		},
 		[]string{"BTC/USDT"},
-		database.NewInteractor(database.NewInternalConnector()),
+		interactor,
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.authData.ApiKey != "key" || e.authData.ApiSecret != "secret" || e.authData.Passphrase != "passphrase" {
+		t.Errorf("Auth data is not set correctly: %v", e.authData)
+	}
+
+	if err := e.Start(); err != nil {
+		t.Fatal("Can't start okx:", err)
+	}
 
-	if e.authData.ApiKey != os.Getenv("TEST_OKX_API_KEY") {
-		t.Errorf("API Key is not set correctly.\nExpected:\n\t%s\nActual:\n\t%s",
-			os.Getenv("TEST_OKX_API_KEY"), e.authData.ApiKey)
+	expected := database.OrderBook{
+		Asks: map[string]string{"20002": "2"},
+		Bids: map[string]string{"19999": "3", "19998": "4"},
 	}
 
-	if e.authData.ApiSecret != os.Getenv("TEST_OKX_SECRET") {
-		t.Errorf("API Secret is not set correctly.\nExpected:\n\t%s\nActual:\n\t%s",
-			os.Getenv("TEST_OKX_SECRET"), e.authData.ApiSecret)
+	waitFor(t, "the order book", func() bool {
+		orderBook, err := interactor.GetOrderBook("okx", "BTC/USDT")
+		return err == nil && reflect.DeepEqual(*orderBook, expected)
+	})
+
+	waitFor(t, "the balance", func() bool {
+		balance, err := interactor.GetBalance("okx", "USDT")
+		return err == nil && balance.Total == 15
+	})
+
+	// The fees are stored as absolute values under the general currency, as the order books are.
+	if fee, err := interactor.GetFee("okx", "BTC/USDT"); err != nil || fee.Taker != 0.001 {
+		t.Errorf("Fee is not stored correctly: %v, %v", fee, err)
 	}
 
-	if e.authData.Passphrase != os.Getenv("TEST_OKX_PASSPHASE") {
-		t.Errorf("API Passphrase is not set correctly.\nExpected:\n\t%s\nActual:\n\t%s",
-			os.Getenv("TEST_OKX_PASSPHASE"), e.authData.Passphrase)
+	waitFor(t, "the readiness", func() bool {
+		health := e.Health()
+		return health.Ready()
+	})
+
+	if health := e.Health(); fmt.Sprint(health.Channels) != "[account books50-l2-tbt orders]" || !health.OrderBooks["BTC/USDT"] ||
+		time.Since(health.LastMessage) > 5*time.Second {
+		t.Errorf("Health Error: unexpected health %+v", health)
+	}
+
+	if err := e.Stop(); err != nil {
+		t.Error("Can't stop okx", err)
+	}
+
+	if health := e.Health(); health.Running || health.Connected || health.Ready() {
+		t.Errorf("Health Error: expected the stopped exchange not to be ready, got %+v", health)
+	}
+}
+
+func TestOkx_WithoutIds(t *testing.T) {
+	// The login and the subscriptions are acknowledged without the ids of the requests.
+	server := exchangetest.NewServer(exchangetest.OkxScriptWithoutIds())
+	defer server.Close()
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewOkx(
+		&Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			Password:        "passphrase",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
+		},
+		[]string{"BTC/USDT"},
+		interactor,
+	)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	if err := e.Start(); err != nil {
-		t.Error("Can't start okx:", err)
+		t.Fatal("Can't start okx:", err)
 	}
+	defer e.Stop()
+
+	waitFor(t, "the readiness", func() bool {
+		health := e.Health()
+		return health.Ready()
+	})
+
+	if health := e.Health(); !health.LoggedIn {
+		t.Errorf("Health Error: expected okx to be logged in, got %+v", health)
+	}
+}
+
+func TestNewOkx_Error(t *testing.T) {
+	interactor := database.NewInteractor(database.NewInternalConnector())
+
+	for _, test := range []struct {
+		name     string
+		settings *Settings
+	}{
+		{"missing passphrase", &Settings{ApiKey: "key", Secret: "secret"}},
+		{"invalid pingInterval", &Settings{ApiKey: "key", Secret: "secret", Password: "passphrase", PingInterval: -time.Second}},
+		{"invalid channel", &Settings{ApiKey: "key", Secret: "secret", Password: "passphrase", Channels: []string{"trades"}}},
+		{"invalid websocketApiUrl", &Settings{ApiKey: "key", Secret: "secret", Password: "passphrase", WebsocketApiURL: "localhost"}},
+	} {
+		if e, err := NewOkx(test.settings, []string{"BTC/USDT"}, interactor); err == nil || e != nil {
+			t.Errorf("NewOkx Error: expected an error of the %s, got %v", test.name, err)
+		}
+	}
+
+	if e, err := NewGateio(&Settings{ApiKey: "key", Secret: "secret", MaxSubscriptionsPerConnection: -1},
+		[]string{"BTC/USDT"}, interactor); err == nil || e != nil {
+		t.Errorf("NewGateio Error: expected an error of the invalid maxSubscriptionsPerConnection, got %v", err)
+	}
+}
+
+func TestOkx_Channels(t *testing.T) {
+	server := exchangetest.NewOkxServer()
+	defer server.Close()
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewOkx(
+		&Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			Password:        "passphrase",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
+			PingInterval:    5 * time.Second,
+			Channels:        []string{ChannelOrderBook},
+		},
+		[]string{"BTC/USDT"},
+		interactor,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.aliveSignalInterval != 5*time.Second {
+		t.Errorf("Ping interval is not set correctly: %v", e.aliveSignalInterval)
+	}
+
+	var logs syncBuffer
+	e.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	if err := e.Start(); err != nil {
+		t.Fatal("Can't start okx:", err)
+	}
+
+	waitFor(t, "the order book", func() bool {
+		_, err := interactor.GetOrderBook("okx", "BTC/USDT")
+		return err == nil
+	})
+
+	waitFor(t, "the subscription log", func() bool {
+		return strings.Contains(logs.String(), "msg=subscribed exchange=okx channel=books50-l2-tbt currency=BTC/USDT")
+	})
 
 	if err := e.Stop(); err != nil {
 		t.Error("Can't stop okx", err)
 	}
+
+	for _, message := range server.Received() {
+		if strings.Contains(message, `"account"`) || strings.Contains(message, `"orders"`) {
+			t.Errorf("The disabled channels should not be subscribed: %s", message)
+		}
+	}
+}
+
+func TestOkx_UpdateCurrencies(t *testing.T) {
+	server := exchangetest.NewOkxServer()
+	defer server.Close()
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewOkx(
+		&Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			Password:        "passphrase",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
+		},
+		[]string{"BTC/USDT"},
+		interactor,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Start(); err != nil {
+		t.Fatal("Can't start okx:", err)
+	}
+	defer e.Stop()
+
+	waitFor(t, "the order book of BTC/USDT", func() bool {
+		_, err := interactor.GetOrderBook("okx", "BTC/USDT")
+		return err == nil
+	})
+
+	connections := server.Connections()
+
+	if err := e.UpdateCurrencies([]string{"ETH/USDT"}); err != nil {
+		t.Fatal("Can't update the currencies:", err)
+	}
+
+	waitFor(t, "the order book of ETH/USDT", func() bool {
+		_, err := interactor.GetOrderBook("okx", "ETH/USDT")
+		return err == nil
+	})
+
+	if _, err := interactor.GetOrderBook("okx", "BTC/USDT"); err == nil {
+		t.Error("The order book of the removed currency should be deleted")
+	}
+
+	if !reflect.DeepEqual(e.getCurrencies(), []string{"ETH/USDT"}) {
+		t.Errorf("Currencies are not updated: %v", e.getCurrencies())
+	}
+
+	if server.Connections() != connections {
+		t.Errorf("The connections should be kept: expected %d, got %d", connections, server.Connections())
+	}
+
+	unsubscribed := false
+	for _, message := range server.Received() {
+		if strings.Contains(message, `"unsubscribe"`) && strings.Contains(message, "BTC-USDT") {
+			unsubscribed = true
+		}
+	}
+
+	if !unsubscribed {
+		t.Error("The removed currency is not unsubscribed")
+	}
+}
+
+func TestOkx_Ping(t *testing.T) {
+	server := exchangetest.NewOkxServer()
+	defer server.Close()
+
+	rejecting := exchangetest.NewServer(&exchangetest.Script{
+		Rest: map[string]string{
+			"GET /api/v5/account/config": `{"code":"50113","msg":"Invalid Sign","data":[]}`,
+		},
+	})
+	defer rejecting.Close()
+
+	for _, test := range []struct {
+		server *exchangetest.Server
+		code   string
+	}{
+		{server: server},
+		{server: rejecting, code: "50113"},
+	} {
+		e, err := NewOkx(
+			&Settings{
+				ApiKey:          "key",
+				Secret:          "secret",
+				Password:        "passphrase",
+				WebsocketApiURL: test.server.URL,
+				RestApiURL:      test.server.RestURL,
+			},
+			[]string{"BTC/USDT"},
+			database.NewInteractor(database.NewInternalConnector()),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var requestErr *RequestError
+		if err := e.Ping(); test.code == "" && err != nil {
+			t.Errorf("Ping Error: %v", err)
+		} else if test.code != "" && (!errors.As(err, &requestErr) || requestErr.Code != test.code) {
+			t.Errorf("Ping Error: expected the code %s, got %v", test.code, err)
+		}
+	}
+}
+
+// syncBuffer collects the logs written by the handlers of the connections.
+type syncBuffer struct {
+	mux    sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.buffer.Write(data)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.buffer.String()
+}
+
+// waitFor polls the condition until it holds, the messages are handled asynchronously.
+func waitFor(t *testing.T, name string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Errorf("Timed out waiting for %s", name)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
 
 func TestOkx_RestApi_(t *testing.T) {
-	e := NewOkx(
-		map[string]string{
-			"apiKey":   os.Getenv("TEST_OKX_API_KEY"),
-			"secret":   os.Getenv("TEST_OKX_SECRET"),
-			"password": os.Getenv("TEST_OKX_PASSPHASE"),
+	// The test calls the real OKX with the credentials of the environment, it is skipped without them.
+	if os.Getenv("TEST_OKX_API_KEY") == "" {
+		t.Skip("TEST_OKX_API_KEY is not set")
+	}
+
+	e, err := NewOkx(
+		&Settings{
+			ApiKey:   os.Getenv("TEST_OKX_API_KEY"),
+			Secret:   os.Getenv("TEST_OKX_SECRET"),
+			Password: os.Getenv("TEST_OKX_PASSPHASE"),
 		},
 		[]string{"BTC/USDT"},
 		database.NewInteractor(database.NewInternalConnector()),
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	e.restClient = &http.Client{}
 
@@ -82,3 +390,87 @@ func TestOkx_RestApi_(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestOkx_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "okx-public.jsonl")
+
+	recorder, err := wsclt.NewFileRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.Record(wsclt.DirectionOutbound, websocket.TextMessage, []byte(`{"op":"subscribe"}`))
+	recorder.Record(wsclt.DirectionInbound, websocket.TextMessage, []byte(`{"arg":{"channel":"books50-l2-tbt","instId":"BTC-USDT"},"action":"snapshot","data":[{"asks":[["20001","1"],["20002","2"]],"bids":[["19999","3"]]}]}`))
+	recorder.Record(wsclt.DirectionInbound, websocket.TextMessage, []byte(`{"arg":{"channel":"books50-l2-tbt","instId":"BTC-USDT"},"action":"update","data":[{"asks":[["20001","0"]],"bids":[["19998","4"]],"ts":"1597026383085"}]}`))
+	recorder.Record(wsclt.DirectionInbound, websocket.TextMessage, []byte("pong"))
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	interactor := database.NewInteractor(database.NewInternalConnector())
+	e, err := NewOkx(
+		&Settings{ApiKey: "key", Secret: "secret", Password: "passphrase"},
+		[]string{"BTC/USDT"},
+		interactor,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchangeMetrics := NewMetrics(metrics.NewRegistry())
+	e.SetMetrics(exchangeMetrics)
+
+	if err := e.ReplayPublic(context.Background(), path, 0); err != nil {
+		t.Fatal("Can't replay okx:", err)
+	}
+
+	expected := database.OrderBook{
+		Asks: map[string]string{"20002": "2"},
+		Bids: map[string]string{"19999": "3", "19998": "4"},
+	}
+
+	if orderBook, err := interactor.GetOrderBook("okx", "BTC/USDT"); err != nil {
+		t.Error("Can't get order book:", err)
+	} else if !reflect.DeepEqual(*orderBook, expected) {
+		t.Errorf("Order book is not replayed correctly.\nExpected:\n\t%v\nActual:\n\t%v", expected, *orderBook)
+	}
+
+	// Only the update carries the exchange timestamp.
+	if stats, ok := e.Latencies()["books50-l2-tbt"]; !ok || stats.Samples != 1 {
+		t.Errorf("Expected 1 latency sample of books50-l2-tbt, got %v", e.Latencies())
+	}
+
+	// The recorded heartbeats are skipped as the client does.
+	if value := exchangeMetrics.ParseErrors.With("okx", "unknown").Value(); value != 0 {
+		t.Errorf("Expected no parse errors, got %v", value)
+	}
+}
+
+func TestOkx_OrderBookError(t *testing.T) {
+	e, err := NewOkx(
+		&Settings{ApiKey: "key", Secret: "secret", Password: "passphrase"},
+		[]string{"BTC/USDT"},
+		database.NewInteractor(database.NewInternalConnector()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.runningMux.Lock()
+	failed, _ := e.beginRun()
+	e.runningMux.Unlock()
+
+	e.handlePublicMessage([]byte(`{"arg":{"channel":"books50-l2-tbt","instId":"BTC-USDT"},"action":"update","data":"malformed"}`))
+
+	// The order book can't be trusted anymore, so the run fails and the supervisor restarts it.
+	select {
+	case <-failed:
+	default:
+		t.Fatal("Expected the run to fail")
+	}
+
+	if err := e.Err(); err == nil || !strings.HasPrefix(err.Error(), "can't update the order book") {
+		t.Errorf("Err Error: expected the failed update, got %v", err)
+	}
+}
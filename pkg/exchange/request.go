@@ -0,0 +1,134 @@
+package exchange
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRequestTimeout applies to the requests whose context has no deadline.
+const defaultRequestTimeout = 10 * time.Second
+
+// RequestError is the error reported by the exchange in the response of a request.
+type RequestError struct {
+	Code    string
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return "request failed with code " + e.Code + ": " + e.Message
+}
+
+type requestResult struct {
+	message []byte
+	err     error
+}
+
+// pendingRequests matches the responses to the requests waiting for them by the request id,
+// the zero value is ready to use.
+type pendingRequests struct {
+	mux     sync.Mutex
+	lastId  uint64
+	waiting map[string]chan requestResult
+	// ops are the operations of the waiting requests, so the responses without the id can be matched.
+	ops map[string]string
+}
+
+func (p *pendingRequests) add(op string) (uint64, chan requestResult) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.waiting == nil {
+		p.waiting = make(map[string]chan requestResult)
+		p.ops = make(map[string]string)
+	}
+
+	p.lastId++
+	id := strconv.FormatUint(p.lastId, 10)
+	result := make(chan requestResult, 1)
+	p.waiting[id] = result
+	p.ops[id] = op
+
+	return p.lastId, result
+}
+
+func (p *pendingRequests) remove(id uint64) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	delete(p.waiting, strconv.FormatUint(id, 10))
+	delete(p.ops, strconv.FormatUint(id, 10))
+}
+
+// resolve hands the response to the waiting request, it reports false if nobody is waiting for the id,
+// e.g. the request has timed out or the message was not sent by Request.
+func (p *pendingRequests) resolve(id string, message []byte, err error) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return p.resolveLocked(id, message, err)
+}
+
+func (p *pendingRequests) resolveLocked(id string, message []byte, err error) bool {
+	result, ok := p.waiting[id]
+	if !ok {
+		return false
+	}
+
+	delete(p.waiting, id)
+	delete(p.ops, id)
+	result <- requestResult{message: message, err: err}
+
+	return true
+}
+
+// resolveOp hands the response without the id to the oldest request waiting for the operation,
+// it reports false if nobody is waiting for it.
+func (p *pendingRequests) resolveOp(op string, message []byte, err error) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	var oldest uint64
+	for id, value := range p.ops {
+		if number, parseErr := strconv.ParseUint(id, 10, 64); parseErr == nil && value == op && (oldest == 0 || number < oldest) {
+			oldest = number
+		}
+	}
+
+	if oldest == 0 {
+		return false
+	}
+
+	return p.resolveLocked(strconv.FormatUint(oldest, 10), message, err)
+}
+
+// request sends the message tagged with a new id and waits for the matching response,
+// the default timeout is applied if the context has no deadline.
+func (e *Exchange) request(ctx context.Context, send func(id uint64) error) ([]byte, error) {
+	return e.requestOp(ctx, "", send)
+}
+
+// requestOp is request whose response may also be matched by the operation, e.g. login,
+// for the exchanges which don't always echo the id.
+func (e *Exchange) requestOp(ctx context.Context, op string, send func(id uint64) error) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+
+	id, result := e.pending.add(op)
+	defer e.pending.remove(id)
+
+	if err := send(id); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-result:
+		return r.message, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
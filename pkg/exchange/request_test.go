@@ -0,0 +1,91 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"markets/pkg/database"
+)
+
+func TestRequest(t *testing.T) {
+	e, err := NewOkx(
+		&Settings{ApiKey: "key", Secret: "secret", Password: "passphrase"},
+		[]string{"BTC/USDT"},
+		database.NewInteractor(database.NewInternalConnector()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The responses are fed to the message handler as if they were received from the connection.
+	respond := func(format string) func(id uint64) error {
+		return func(id uint64) error {
+			go e.handlePrivateMessage([]byte(fmt.Sprintf(format, id)))
+			return nil
+		}
+	}
+
+	if response, err := e.request(context.Background(), respond(`{"id":"%d","event":"login","code":"0","msg":""}`)); err != nil {
+		t.Errorf("Request Error: %v", err)
+	} else if string(response) == "" {
+		t.Errorf("Request Error: empty response")
+	}
+
+	var requestErr *RequestError
+	if _, err := e.request(context.Background(), respond(`{"id":"%d","event":"error","code":"60012","msg":"Invalid request"}`)); !errors.As(err, &requestErr) || requestErr.Code != "60012" {
+		t.Errorf("Expected RequestError with code 60012, got %v", err)
+	}
+
+	// The login is acknowledged without the id, and so is its failure.
+	respondWithoutId := func(message string) func(id uint64) error {
+		return func(uint64) error {
+			go e.handlePrivateMessage([]byte(message))
+			return nil
+		}
+	}
+
+	if _, err := e.requestOp(context.Background(), "login", respondWithoutId(`{"event":"login","code":"0","msg":""}`)); err != nil {
+		t.Errorf("Request Error: %v", err)
+	}
+
+	if _, err := e.requestOp(context.Background(), "login", respondWithoutId(`{"event":"error","code":"60009","msg":"Login failed"}`)); !errors.As(err, &requestErr) || requestErr.Code != "60009" {
+		t.Errorf("Expected RequestError with code 60009, got %v", err)
+	}
+
+	// The response of another request does not resolve this one.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := e.request(ctx, func(id uint64) error {
+		go e.handlePrivateMessage([]byte(fmt.Sprintf(`{"id":"%d","event":"login","code":"0"}`, id+100)))
+		return nil
+	}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+
+	g, err := NewGateio(
+		&Settings{ApiKey: "key", Secret: "secret"},
+		[]string{"BTC/USDT"},
+		database.NewInteractor(database.NewInternalConnector()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.request(context.Background(), func(id uint64) error {
+		go g.handleMessage([]byte(fmt.Sprintf(`{"id":%d,"channel":"spot.orders","event":"subscribe","error":null,"result":{"status":"success"}}`, id)))
+		return nil
+	}); err != nil {
+		t.Errorf("Gateio Request Error: %v", err)
+	}
+
+	if _, err := g.request(context.Background(), func(id uint64) error {
+		go g.handleMessage([]byte(fmt.Sprintf(`{"id":%d,"channel":"spot.orders","event":"subscribe","error":{"code":2,"message":"invalid argument"}}`, id)))
+		return nil
+	}); !errors.As(err, &requestErr) || requestErr.Code != "2" {
+		t.Errorf("Expected RequestError with code 2, got %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"markets/pkg/logging"
+)
+
+// Monitored is implemented by the exchanges which report when their run stops by itself,
+// e.g. because a connection is lost, so the supervisor can start them again.
+type Monitored interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+type SupervisorOptions struct {
+	// MinBackoff is the delay before the first restart, 1 second by default.
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay, which doubles after every failure, 1 minute by default.
+	MaxBackoff time.Duration
+	// StableAfter resets the delay to MinBackoff if the run has lasted longer, 1 minute by default.
+	StableAfter time.Duration
+	// HistorySize is the number of restarts kept for every exchange, 100 by default.
+	HistorySize int
+	// Metrics counts the restarts, they are not counted if it is nil.
+	Metrics *Metrics
+	// Logger receives the failures and the restarts, slog.Default() is used if it is nil.
+	Logger *slog.Logger
+}
+
+// Restart describes why the run of an exchange has ended and when it is started again.
+type Restart struct {
+	// Time is when the run has failed.
+	Time  time.Time
+	Error error
+	// Delay is how long the supervisor waits before starting the exchange again.
+	Delay time.Duration
+}
+
+type supervised struct {
+	name     string
+	exchange Exchanger
+
+	// historyMux guards the restarts, which are read while the exchange is supervised.
+	historyMux sync.Mutex
+	restarts   []Restart
+	total      int
+
+	done    chan struct{}
+	stopErr error
+}
+
+// Supervisor runs every exchange on its own, the panics and the failures of one exchange don't affect
+// the others. A failed exchange is started again with an exponential backoff until the supervisor stops.
+type Supervisor struct {
+	options   SupervisorOptions
+	logger    *slog.Logger
+	exchanges []*supervised
+
+	mux     sync.Mutex
+	cancel  context.CancelFunc
+	started bool
+}
+
+// safely calls the function, a panic is returned as an error.
+func safely(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return f()
+}
+
+// Add supervises the exchange, it must be called before Start.
+func (s *Supervisor) Add(name string, e Exchanger) {
+	s.exchanges = append(s.exchanges, &supervised{
+		name:     name,
+		exchange: e,
+		done:     make(chan struct{}),
+	})
+}
+
+// Start starts every exchange in the background, the failures are retried until Stop.
+func (s *Supervisor) Start() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.started {
+		return errors.New("supervisor is already started")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.started = true
+
+	for _, entry := range s.exchanges {
+		go s.supervise(ctx, entry)
+	}
+
+	return nil
+}
+
+// run starts the exchange and waits until its run ends by itself or the context is done,
+// it returns why the run has ended, or nil if the context is done.
+func (s *Supervisor) run(ctx context.Context, entry *supervised) error {
+	if err := safely(entry.exchange.Start); err != nil {
+		// The exchange may be left half started by a panic.
+		_ = safely(entry.exchange.Stop)
+		return fmt.Errorf("can't start: %w", err)
+	}
+
+	// The exchanges which don't report their end are only started again if they fail to start.
+	var done <-chan struct{}
+	monitored, ok := entry.exchange.(Monitored)
+	if ok {
+		done = monitored.Done()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-done:
+		err := monitored.Err()
+		if err == nil {
+			err = errors.New("stopped unexpectedly")
+		}
+
+		_ = safely(entry.exchange.Stop)
+		return err
+	}
+}
+
+func (s *Supervisor) supervise(ctx context.Context, entry *supervised) {
+	defer close(entry.done)
+
+	logger := s.logger.With(logging.KeyExchange, entry.name)
+	backoff := s.options.MinBackoff
+
+	for {
+		started := time.Now()
+		err := s.run(ctx, entry)
+		if ctx.Err() != nil {
+			break
+		}
+
+		if time.Since(started) >= s.options.StableAfter {
+			backoff = s.options.MinBackoff
+		}
+
+		entry.historyMux.Lock()
+		entry.restarts = append(entry.restarts, Restart{Time: time.Now(), Error: err, Delay: backoff})
+		if len(entry.restarts) > s.options.HistorySize {
+			entry.restarts = entry.restarts[len(entry.restarts)-s.options.HistorySize:]
+		}
+		entry.total++
+		entry.historyMux.Unlock()
+
+		if s.options.Metrics != nil {
+			s.options.Metrics.Restarts.With(entry.name).Inc()
+		}
+
+		logger.Error("the exchange has failed, restarting", "error", err, "delay", backoff)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		backoff *= 2
+		if backoff > s.options.MaxBackoff {
+			backoff = s.options.MaxBackoff
+		}
+	}
+
+	entry.stopErr = safely(entry.exchange.Stop)
+	if entry.stopErr != nil {
+		logger.Error("can't stop the exchange", "error", entry.stopErr)
+	} else {
+		logger.Info("stopped the exchange")
+	}
+}
+
+// Stop stops restarting the exchanges and stops them in parallel. It stops waiting once the context is done,
+// the exchanges which have not stopped in time, e.g. because they are still starting, are reported in the error.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mux.Lock()
+	if !s.started {
+		s.mux.Unlock()
+		return nil
+	}
+
+	s.started = false
+	s.cancel()
+	s.mux.Unlock()
+
+	var errs []error
+	var pending []string
+
+	for _, entry := range s.exchanges {
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+		}
+
+		// The exchanges which have stopped are reported even though the context is done.
+		select {
+		case <-entry.done:
+			if entry.stopErr != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", entry.name, entry.stopErr))
+			}
+		default:
+			pending = append(pending, entry.name)
+		}
+	}
+
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		errs = append(errs, fmt.Errorf("timed out stopping %v: %w", pending, ctx.Err()))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Restarts returns the recent restarts of the exchange in order, and the number of all restarts.
+func (s *Supervisor) Restarts(name string) ([]Restart, int) {
+	for _, entry := range s.exchanges {
+		if entry.name == name {
+			entry.historyMux.Lock()
+			defer entry.historyMux.Unlock()
+
+			return append([]Restart(nil), entry.restarts...), entry.total
+		}
+	}
+
+	return nil, 0
+}
+
+// IsSupervising tells whether the supervisor has been started and not stopped yet.
+func (s *Supervisor) IsSupervising() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.started
+}
+
+func NewSupervisor(options *SupervisorOptions) *Supervisor {
+	s := &Supervisor{
+		options: SupervisorOptions{
+			MinBackoff:  time.Second,
+			MaxBackoff:  time.Minute,
+			StableAfter: time.Minute,
+			HistorySize: 100,
+		},
+		logger: slog.Default(),
+	}
+
+	if options != nil {
+		if options.MinBackoff > 0 {
+			s.options.MinBackoff = options.MinBackoff
+		}
+		if options.MaxBackoff > 0 {
+			s.options.MaxBackoff = options.MaxBackoff
+		}
+		if options.StableAfter > 0 {
+			s.options.StableAfter = options.StableAfter
+		}
+		if options.HistorySize > 0 {
+			s.options.HistorySize = options.HistorySize
+		}
+		if options.Logger != nil {
+			s.logger = options.Logger
+		}
+		s.options.Metrics = options.Metrics
+	}
+
+	return s
+}
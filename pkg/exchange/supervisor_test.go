@@ -0,0 +1,217 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"markets/pkg/database"
+	"markets/pkg/exchange/exchangetest"
+	"markets/pkg/metrics"
+)
+
+// fakeExchange panics on the first starts, then runs until it is failed or stopped.
+type fakeExchange struct {
+	mux     sync.Mutex
+	panics  int
+	starts  int
+	stops   int
+	stopped chan struct{}
+	err     error
+}
+
+func (f *fakeExchange) Start() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.starts++
+	if f.panics > 0 {
+		f.panics--
+		panic("can't start")
+	}
+
+	f.stopped = make(chan struct{})
+	f.err = nil
+	return nil
+}
+
+func (f *fakeExchange) Stop() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.stops++
+	if f.stopped != nil {
+		select {
+		case <-f.stopped:
+		default:
+			close(f.stopped)
+		}
+	}
+	return nil
+}
+
+func (f *fakeExchange) fail(err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.err = err
+	close(f.stopped)
+}
+
+func (f *fakeExchange) Done() <-chan struct{} {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.stopped
+}
+
+func (f *fakeExchange) Err() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.err
+}
+
+func (f *fakeExchange) count() (starts int, stops int) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.starts, f.stops
+}
+
+func (f *fakeExchange) UpdateCurrencies(currencies []string) error {
+	return nil
+}
+
+func (f *fakeExchange) Ping() error {
+	return nil
+}
+
+func TestSupervisor(t *testing.T) {
+	exchangeMetrics := NewMetrics(metrics.NewRegistry())
+	supervisor := NewSupervisor(&SupervisorOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		Metrics:    exchangeMetrics,
+	})
+
+	panicking := &fakeExchange{panics: 3}
+	healthy := &fakeExchange{}
+	supervisor.Add("panicking", panicking)
+	supervisor.Add("healthy", healthy)
+
+	if err := supervisor.Start(); err != nil {
+		t.Fatal("Can't start the supervisor:", err)
+	}
+	if err := supervisor.Start(); err == nil {
+		t.Error("Start Error: expected the supervisor not to start twice")
+	}
+
+	waitFor(t, "the panicking exchange", func() bool {
+		starts, _ := panicking.count()
+		return starts == 4
+	})
+
+	restarts, total := supervisor.Restarts("panicking")
+	if total != 3 || len(restarts) != 3 || !strings.Contains(restarts[0].Error.Error(), "can't start") {
+		t.Errorf("Restarts Error: expected 3 restarts after the panics, got %d %+v", total, restarts)
+	}
+	if restarts[0].Delay != 10*time.Millisecond || restarts[1].Delay != 20*time.Millisecond ||
+		restarts[2].Delay != 20*time.Millisecond {
+		t.Errorf("Restarts Error: expected the backoff to double up to the max, got %+v", restarts)
+	}
+
+	// The failures of one exchange don't affect the others.
+	if starts, stops := healthy.count(); starts != 1 || stops != 0 {
+		t.Errorf("Supervisor Error: expected the healthy exchange to run once, got %d starts %d stops", starts, stops)
+	}
+
+	healthy.fail(errors.New("connection is lost"))
+
+	waitFor(t, "the failed exchange", func() bool {
+		starts, _ := healthy.count()
+		return starts == 2
+	})
+
+	if restarts, total := supervisor.Restarts("healthy"); total != 1 || restarts[0].Error.Error() != "connection is lost" {
+		t.Errorf("Restarts Error: expected the lost connection, got %d %+v", total, restarts)
+	}
+	if value := exchangeMetrics.Restarts.With("panicking").Value(); value != 3 {
+		t.Errorf("Metrics Error: expected 3 restarts, got %v", value)
+	}
+
+	if !supervisor.IsSupervising() {
+		t.Error("Supervisor Error: expected the supervisor to be supervising")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := supervisor.Stop(ctx); err != nil {
+		t.Error("Can't stop the supervisor:", err)
+	}
+
+	if _, stops := healthy.count(); stops < 2 {
+		t.Errorf("Stop Error: expected the healthy exchange to be stopped, got %d stops", stops)
+	}
+	if supervisor.IsSupervising() {
+		t.Error("Supervisor Error: expected the supervisor to be stopped")
+	}
+}
+
+func TestSupervisor_Gateio(t *testing.T) {
+	server := exchangetest.NewGateioServer()
+	defer server.Close()
+
+	e, err := NewGateio(
+		&Settings{
+			ApiKey:          "key",
+			Secret:          "secret",
+			WebsocketApiURL: server.URL,
+			RestApiURL:      server.RestURL,
+		},
+		[]string{"BTC/USDT"},
+		database.NewInteractor(database.NewInternalConnector()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	supervisor := NewSupervisor(&SupervisorOptions{MinBackoff: 10 * time.Millisecond})
+	supervisor.Add("gateio", e)
+
+	if err := supervisor.Start(); err != nil {
+		t.Fatal("Can't start the supervisor:", err)
+	}
+
+	waitFor(t, "the readiness", func() bool {
+		health := e.Health()
+		return health.Ready()
+	})
+
+	e.fail(errors.New("can't update the order book"))
+
+	waitFor(t, "the restart", func() bool {
+		_, total := supervisor.Restarts("gateio")
+		health := e.Health()
+		return total == 1 && health.Ready()
+	})
+
+	if restarts, _ := supervisor.Restarts("gateio"); len(restarts) != 1 ||
+		restarts[0].Error.Error() != "can't update the order book" {
+		t.Errorf("Restarts Error: expected the failed update, got %+v", restarts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := supervisor.Stop(ctx); err != nil {
+		t.Error("Can't stop the supervisor:", err)
+	}
+	if e.IsRunning() {
+		t.Error("Stop Error: expected gateio to be stopped")
+	}
+}
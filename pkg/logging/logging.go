@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// The keys of the fields shared by the components, so the logs of a venue can be filtered consistently.
+const (
+	KeyComponent = "component"
+	KeyExchange  = "exchange"
+	KeyCurrency  = "currency"
+	KeyChannel   = "channel"
+)
+
+// The output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type Options struct {
+	// Format is text or json, text by default.
+	Format string
+	// Level is the minimum level of the components without their own level.
+	Level slog.Level
+	// Levels overrides the minimum level of the components, e.g. {"wsclt": slog.LevelDebug}.
+	Levels map[string]slog.Level
+	// File is the path of the log file rotated by Rotate, the logs are written to Output if it is empty.
+	File   string
+	Rotate RotateOptions
+	// Output is os.Stderr by default.
+	Output io.Writer
+}
+
+// ParseLevel parses debug, info, warn or error case-insensitively.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToLower(value))); err != nil {
+		return 0, errors.New("unsupported log level: " + value)
+	}
+
+	return level, nil
+}
+
+// componentHandler filters the records by the level of the component.
+type componentHandler struct {
+	handler slog.Handler
+	level   slog.Level
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.handler.Enabled(ctx, level)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{handler: h.handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{handler: h.handler.WithGroup(name), level: h.level}
+}
+
+// Logging builds the loggers of the components, they share the output.
+type Logging struct {
+	options *Options
+	handler slog.Handler
+	file    *RotatingFile
+}
+
+// Logger returns the logger of the component, every record carries the component field.
+func (l *Logging) Logger(component string) *slog.Logger {
+	level, ok := l.options.Levels[component]
+	if !ok {
+		level = l.options.Level
+	}
+
+	return slog.New(&componentHandler{handler: l.handler, level: level}).With(KeyComponent, component)
+}
+
+// Close closes the log file.
+func (l *Logging) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+func New(options *Options) (*Logging, error) {
+	l := &Logging{options: options}
+
+	output := options.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	if options.File != "" {
+		file, err := NewRotatingFile(options.File, &options.Rotate)
+		if err != nil {
+			return nil, err
+		}
+
+		l.file = file
+		output = file
+	}
+
+	// The levels are filtered by the components, so the handler passes every record.
+	handlerOptions := &slog.HandlerOptions{Level: slog.Level(-8)}
+
+	switch options.Format {
+	case "", FormatText:
+		l.handler = slog.NewTextHandler(output, handlerOptions)
+	case FormatJSON:
+		l.handler = slog.NewJSONHandler(output, handlerOptions)
+	default:
+		_ = l.Close()
+		return nil, errors.New("unsupported log format: " + options.Format)
+	}
+
+	return l, nil
+}
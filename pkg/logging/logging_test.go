@@ -0,0 +1,153 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogging(t *testing.T) {
+	var output bytes.Buffer
+
+	logs, err := New(&Options{
+		Format: FormatJSON,
+		Level:  slog.LevelInfo,
+		Levels: map[string]slog.Level{"wsclt": slog.LevelWarn},
+		Output: &output,
+	})
+	if err != nil {
+		t.Fatal("Logging New Error:", err)
+	}
+
+	logs.Logger("exchange").With(KeyExchange, "okx").Info("subscribed", KeyChannel, "books", KeyCurrency, "BTC/USDT")
+	logs.Logger("exchange").Debug("filtered by the default level")
+	logs.Logger("wsclt").Info("filtered by the level of the component")
+	logs.Logger("wsclt").Warn("connection closed")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Logging Error: expected 2 records, got\n%s", output.String())
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal("Logging Error:", err)
+	}
+
+	for key, value := range map[string]string{
+		"msg":        "subscribed",
+		KeyComponent: "exchange",
+		KeyExchange:  "okx",
+		KeyChannel:   "books",
+		KeyCurrency:  "BTC/USDT",
+	} {
+		if record[key] != value {
+			t.Errorf("Logging Error: expected %s=%s in %s", key, value, lines[0])
+		}
+	}
+
+	if _, err := New(&Options{Format: "xml"}); err == nil {
+		t.Error("Logging New Error: expected an error for the unsupported format")
+	}
+
+	if level, err := ParseLevel("WARN"); err != nil || level != slog.LevelWarn {
+		t.Errorf("Logging ParseLevel Error: %v, %v", level, err)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "market-update.log")
+
+	f, err := NewRotatingFile(path, &RotateOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal("RotatingFile Open Error:", err)
+	}
+
+	// The other files sharing the prefix are not backups, so they are never pruned even if they sort first.
+	unrelated := filepath.Join(filepath.Dir(path), "market-update-2019.log")
+	if err := os.WriteFile(unrelated, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal("RotatingFile Write Error:", err)
+		}
+	}
+
+	if backups, err := f.backups(); err != nil || len(backups) != 2 {
+		t.Errorf("RotatingFile Error: expected 2 backups, got %v, %v", backups, err)
+	} else if data, _ := os.ReadFile(backups[1]); string(data) != "line 3\n" {
+		t.Errorf("RotatingFile Error: expected the newest backup to be line 3, got %q", data)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "line 4\n" {
+		t.Errorf("RotatingFile Error: expected the current file to be line 4, got %q", data)
+	}
+
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("RotatingFile Error: the unrelated file should be kept, got %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Error("RotatingFile Close Error:", err)
+	}
+
+	// The file is rotated once it is older than the interval.
+	f, err = NewRotatingFile(path, &RotateOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal("RotatingFile Open Error:", err)
+	}
+	defer f.Close()
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := f.Write([]byte("line 5\n")); err != nil {
+		t.Fatal("RotatingFile Write Error:", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "line 5\n" {
+		t.Errorf("RotatingFile Error: expected the file to be rotated by time, got %q", data)
+	}
+}
+
+func TestRotatingFile_RenameError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "market-update.log")
+
+	f, err := NewRotatingFile(path, &RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal("RotatingFile Open Error:", err)
+	}
+	defer f.Close()
+
+	renameErr := errors.New("rename failed")
+	renameFile = func(string, string) error { return renameErr }
+	defer func() { renameFile = os.Rename }()
+
+	for _, line := range []string{"line 1\n", "line 2\n"} {
+		if _, err := f.Write([]byte(line)); err != nil && !errors.Is(err, renameErr) {
+			t.Fatal("RotatingFile Write Error:", err)
+		}
+	}
+
+	// The original file is kept open, so the logs are not lost while it can't be rotated.
+	if data, _ := os.ReadFile(path); string(data) != "line 1\nline 2\n" {
+		t.Errorf("RotatingFile Error: expected both lines in the original file, got %q", data)
+	}
+
+	renameFile = os.Rename
+
+	if _, err := f.Write([]byte("line 3\n")); err != nil {
+		t.Fatal("RotatingFile Write Error:", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "line 3\n" {
+		t.Errorf("RotatingFile Error: expected the file to be rotated once it can be renamed, got %q", data)
+	}
+}
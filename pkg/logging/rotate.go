@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the names of the rotated files, it sorts in chronological order.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// renameFile renames the file being rotated, it is replaced by the tests.
+var renameFile = os.Rename
+
+type RotateOptions struct {
+	// MaxSize is the size in bytes which triggers the rotation, 100 MB by default.
+	MaxSize int64
+	// Interval rotates the file periodically, e.g. daily, the file is only rotated by size if it is 0.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept, all of them are kept if it is 0.
+	MaxBackups int
+}
+
+// RotatingFile is a log file which is renamed with a timestamp and replaced with a new file
+// when it grows too large or gets too old, it is safe for concurrent use.
+type RotatingFile struct {
+	path    string
+	options RotateOptions
+
+	mux sync.Mutex
+	// file is nil if it could not be reopened by the last rotation, it is reopened by the next write.
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+// backups returns the rotated files from the oldest to the newest.
+func (f *RotatingFile) backups() ([]string, error) {
+	extension := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), extension) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, extension) {
+			continue
+		}
+
+		// The other files sharing the prefix, e.g. market-update-old.log, are not backups.
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), extension)
+		if _, err := time.Parse(backupTimeFormat, timestamp); err != nil {
+			continue
+		}
+
+		backups = append(backups, filepath.Join(filepath.Dir(f.path), name))
+	}
+
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// rotate must be called with the lock held, the original file is reopened if it can't be renamed.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+
+	extension := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, extension) + "-" + time.Now().Format(backupTimeFormat) + extension
+	if err := renameFile(f.path, backup); err != nil {
+		if openErr := f.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if f.options.MaxBackups > 0 {
+		backups, err := f.backups()
+		if err != nil {
+			return err
+		}
+
+		for len(backups) > f.options.MaxBackups {
+			if err := os.Remove(backups[0]); err != nil {
+				return err
+			}
+			backups = backups[1:]
+		}
+	}
+
+	return nil
+}
+
+func (f *RotatingFile) Write(data []byte) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	expired := f.options.Interval > 0 && time.Since(f.openedAt) >= f.options.Interval
+	if f.size > 0 && (expired || f.size+int64(len(data)) > f.options.MaxSize) {
+		if err := f.rotate(); err != nil {
+			if f.file == nil {
+				return 0, err
+			}
+
+			// The data is still appended to the original file, which is rotated again by the next write.
+			n, writeErr := f.file.Write(data)
+			f.size += int64(n)
+			return n, errors.Join(err, writeErr)
+		}
+	}
+
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func NewRotatingFile(path string, options *RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path: path,
+		options: RotateOptions{
+			MaxSize: 100 * 1024 * 1024,
+		},
+	}
+
+	if options != nil {
+		if options.MaxSize > 0 {
+			f.options.MaxSize = options.MaxSize
+		}
+
+		f.options.Interval = options.Interval
+		f.options.MaxBackups = options.MaxBackups
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,303 @@
+// Package metrics collects counters and histograms and exposes them in the Prometheus text format.
+//
+// The methods of a nil counter, histogram or vector do nothing, so the instrumented code
+// does not need to check whether the metrics are enabled.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the buckets of the latencies, from 1ms to 10s.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter is a value which only goes up.
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds the value, which must not be negative.
+func (c *Counter) Add(value float64) {
+	if c == nil {
+		return
+	}
+
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+value)) {
+			return
+		}
+	}
+}
+
+func (c *Counter) Value() float64 {
+	if c == nil {
+		return 0
+	}
+
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Histogram counts the observations in cumulative buckets.
+type Histogram struct {
+	mux     sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *Histogram) Observe(value float64) {
+	if h == nil {
+		return
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for index, bound := range h.buckets {
+		if value <= bound {
+			h.counts[index]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+// ObserveSince observes the seconds elapsed since the start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	return h.count
+}
+
+// family is a metric with all its series, keyed by the label values.
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+
+	mux    sync.Mutex
+	series map[string]interface{}
+	values map[string][]string
+}
+
+func (f *family) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if series, ok := f.series[key]; ok {
+		return series
+	}
+
+	series := create()
+	f.series[key] = series
+	f.values[key] = append([]string(nil), labelValues...)
+
+	return series
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	family *family
+}
+
+// With returns the counter of the label values, which are given in the order of the label names.
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	if v == nil {
+		return nil
+	}
+
+	return v.family.get(labelValues, func() interface{} {
+		return &Counter{}
+	}).(*Counter)
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	family *family
+}
+
+// With returns the histogram of the label values, which are given in the order of the label names.
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	if v == nil {
+		return nil
+	}
+
+	buckets := v.family.buckets
+	return v.family.get(labelValues, func() interface{} {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	}).(*Histogram)
+}
+
+// Registry holds the metrics exposed together.
+type Registry struct {
+	mux      sync.Mutex
+	families map[string]*family
+}
+
+func (r *Registry) register(name string, help string, kind string, labelNames []string, buckets []float64) *family {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, ok := r.families[name]; ok {
+		panic("metric " + name + " is already registered")
+	}
+
+	f := &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]interface{}),
+		values:     make(map[string][]string),
+	}
+
+	r.families[name] = f
+	return f
+}
+
+// Counter registers a counter partitioned by the labels.
+func (r *Registry) Counter(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{family: r.register(name, help, "counter", labelNames, nil)}
+}
+
+// Histogram registers a histogram partitioned by the labels, DefaultBuckets are used if the buckets are nil.
+func (r *Registry) Histogram(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &HistogramVec{family: r.register(name, help, "histogram", labelNames, buckets)}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats the labels with the extra label, e.g. le, appended if its name is not empty.
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	var pairs []string
+	for index, name := range names {
+		pairs = append(pairs, name+`="`+labelValueReplacer.Replace(values[index])+`"`)
+	}
+
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// Write writes all metrics in the Prometheus text format, the metrics and their series are sorted.
+func (r *Registry) Write(w io.Writer) error {
+	r.mux.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mux.Unlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	writer := bufio.NewWriter(w)
+
+	for _, f := range families {
+		fmt.Fprintf(writer, "# HELP %s %s\n", f.name, strings.ReplaceAll(f.help, "\n", `\n`))
+		fmt.Fprintf(writer, "# TYPE %s %s\n", f.name, f.kind)
+
+		f.mux.Lock()
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			values := f.values[key]
+
+			switch series := f.series[key].(type) {
+			case *Counter:
+				fmt.Fprintf(writer, "%s%s %s\n", f.name, formatLabels(f.labelNames, values, "", ""), formatValue(series.Value()))
+			case *Histogram:
+				series.mux.Lock()
+				for index, bound := range series.buckets {
+					fmt.Fprintf(writer, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, values, "le", formatValue(bound)), series.counts[index])
+				}
+				fmt.Fprintf(writer, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, values, "le", "+Inf"), series.count)
+				fmt.Fprintf(writer, "%s_sum%s %s\n", f.name, formatLabels(f.labelNames, values, "", ""), formatValue(series.sum))
+				fmt.Fprintf(writer, "%s_count%s %d\n", f.name, formatLabels(f.labelNames, values, "", ""), series.count)
+				series.mux.Unlock()
+			}
+		}
+		f.mux.Unlock()
+	}
+
+	return writer.Flush()
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.Write(w)
+	})
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
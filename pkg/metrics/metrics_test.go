@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	messages := registry.Counter("markets_messages_total", "The received messages.", "exchange", "channel")
+	latency := registry.Histogram("markets_latency_seconds", "The latency.", []float64{0.1, 1}, "exchange")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			messages.With("okx", "books").Inc()
+		}()
+	}
+	wg.Wait()
+
+	messages.With("gateio", `spot "orders"`).Add(2)
+	latency.With("okx").Observe(0.05)
+	latency.With("okx").Observe(0.5)
+	latency.With("okx").Observe(5)
+
+	var buffer bytes.Buffer
+	if err := registry.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP markets_latency_seconds The latency.
+# TYPE markets_latency_seconds histogram
+markets_latency_seconds_bucket{exchange="okx",le="0.1"} 1
+markets_latency_seconds_bucket{exchange="okx",le="1"} 2
+markets_latency_seconds_bucket{exchange="okx",le="+Inf"} 3
+markets_latency_seconds_sum{exchange="okx"} 5.55
+markets_latency_seconds_count{exchange="okx"} 3
+# HELP markets_messages_total The received messages.
+# TYPE markets_messages_total counter
+markets_messages_total{exchange="gateio",channel="spot \"orders\""} 2
+markets_messages_total{exchange="okx",channel="books"} 10
+`
+
+	if buffer.String() != expected {
+		t.Errorf("Write Error: expected\n%s\ngot\n%s", expected, buffer.String())
+	}
+
+	// The nil metrics are disabled.
+	var disabled *CounterVec
+	disabled.With("okx").Inc()
+
+	var disabledHistogram *HistogramVec
+	disabledHistogram.With("okx").Observe(1)
+}
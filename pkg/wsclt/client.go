@@ -1,41 +1,154 @@
 package wsclt
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
+	"log/slog"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+var (
+	ErrAlreadyConnected = errors.New("already connected")
+	ErrClosed           = errors.New("client is closed")
+	ErrPongTimeout      = errors.New("pong timeout")
+)
+
 type Options struct {
 	SkipVerify     bool
 	PingInterval   time.Duration
 	MessageHandler func([]byte)
+	// CloseTimeout is how long Close waits for the server to acknowledge the close frame, 5 seconds by default.
+	CloseTimeout time.Duration
+	// Heartbeat sends the text "ping" and expects the text "pong" by default.
+	Heartbeat Heartbeat
+	// PongTimeout enables the liveness check, the connection is declared dead if nothing proves
+	// the server is alive within PingInterval + PongTimeout.
+	PongTimeout time.Duration
+	// EnableCompression negotiates the permessage-deflate extension with the server.
+	EnableCompression bool
+	// Decoder decompresses the payload of the binary frames, they are passed as they are if it is nil.
+	Decoder Decoder
+	// Recorder receives every raw frame for debugging, the frames are not recorded if it is nil.
+	Recorder Recorder
+	// Proxy is the address of the HTTP CONNECT or SOCKS5 proxy, the connection is direct if it is empty.
+	Proxy string
+	// Queue hands the messages to the handler on a separate goroutine, the handler is called
+	// by the reader directly if it is nil.
+	Queue *QueueOptions
+	// Logger receives the connection events, slog.Default() is used if it is nil.
+	Logger *slog.Logger
+	// Metrics counts the traffic, it is not counted if it is nil.
+	Metrics *Metrics
 }
 
 type Client struct {
 	ws             *websocket.Conn
 	options        *Options
 	messageHandler func([]byte)
+	heartbeat      Heartbeat
+	logger         *slog.Logger
+	lastPong       atomic.Int64
+	decodeErrors   atomic.Uint64
+	queueDrops     atomic.Uint64
 
-	isReading             bool
-	isSending             bool
+	isReading             atomic.Bool
+	isSending             atomic.Bool
 	messageWaitForSending chan []byte
 	sendMux               sync.Mutex
+
+	// stateMux protects the fields describing the current connection below.
+	stateMux   sync.Mutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	readerDone chan struct{}
+	done       chan struct{}
+	err        error
+	queue      *messageQueue
+	// connected tells whether Connect has succeeded before, so the next connection is counted as a reconnect.
+	connected bool
+}
+
+// finish records the reason why the connection ended and stops the other goroutines,
+// only the first reason is kept.
+func (clt *Client) finish(err error) {
+	clt.stateMux.Lock()
+	if clt.err == nil {
+		clt.err = err
+	}
+	cancel := clt.cancel
+	clt.stateMux.Unlock()
+
+	cancel()
 }
 
-func (clt *Client) readMessage() {
-	clt.isReading = true
+func (clt *Client) readMessage(ctx context.Context, ws *websocket.Conn, queue *messageQueue, readerDone chan struct{}) {
+	clt.isReading.Store(true)
 	defer func() {
-		clt.isReading = false
+		clt.isReading.Store(false)
+		close(readerDone)
 	}()
 
 	for {
-		_, message, err := clt.ws.ReadMessage()
+		messageType, message, err := ws.ReadMessage()
 		if err != nil {
-			close(clt.messageWaitForSending)
+			clt.finish(err)
+			return
+		}
+
+		clt.options.Metrics.received(message)
+
+		if clt.options.Recorder != nil {
+			clt.options.Recorder.Record(DirectionInbound, messageType, message)
+		}
+
+		if messageType == websocket.BinaryMessage && clt.options.Decoder != nil {
+			if message, err = clt.options.Decoder(message); err != nil {
+				// A corrupted frame should not bring the connection down.
+				clt.decodeErrors.Add(1)
+				clt.logger.Debug("dropped a frame which can't be decoded", "error", err)
+				continue
+			}
+
+			// The decompressed payloads are texts, so the heartbeat can match them as usual.
+			messageType = websocket.TextMessage
+		}
+
+		if clt.heartbeat.IsPong(messageType, message) {
+			clt.lastPong.Store(time.Now().UnixNano())
+			continue
+		}
+
+		if reply, ok := clt.heartbeat.Reply(messageType, message); ok {
+			clt.lastPong.Store(time.Now().UnixNano())
+			if err := clt.writeMessage(ws, websocket.TextMessage, reply); err != nil {
+				clt.finish(err)
+				return
+			}
+			continue
+		}
+
+		if queue != nil {
+			if err := queue.push(ctx, message); err != nil {
+				clt.finish(err)
+				return
+			}
+		} else if clt.messageHandler != nil {
+			clt.messageHandler(message)
+		}
+	}
+}
+
+// handleQueuedMessages passes the queued messages to the handler until the connection ends.
+func (clt *Client) handleQueuedMessages(ctx context.Context, queue *messageQueue) {
+	for {
+		message, ok := queue.pop(ctx)
+		if !ok {
 			return
 		}
 
@@ -45,42 +158,142 @@ func (clt *Client) readMessage() {
 	}
 }
 
-func (clt *Client) sendMessage() {
-	clt.isSending = true
-	defer func() {
-		clt.isSending = false
-	}()
+func (clt *Client) writeMessage(ws *websocket.Conn, messageType int, data []byte) error {
+	clt.sendMux.Lock()
+	defer clt.sendMux.Unlock()
+
+	if clt.options.Recorder != nil {
+		clt.options.Recorder.Record(DirectionOutbound, messageType, data)
+	}
+
+	if err := ws.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+
+	clt.options.Metrics.sent(data)
+	return nil
+}
+
+func (clt *Client) sendMessage(ctx context.Context, ws *websocket.Conn) {
+	clt.isSending.Store(true)
+	defer clt.isSending.Store(false)
 
 	pingTicker := time.NewTicker(clt.options.PingInterval)
 	defer pingTicker.Stop()
 
+	// A nil channel never fires, so the liveness check is disabled without PongTimeout.
+	var pongCheck <-chan time.Time
+	if clt.options.PongTimeout > 0 {
+		pongCheckTicker := time.NewTicker(clt.options.PongTimeout / 2)
+		defer pongCheckTicker.Stop()
+		pongCheck = pongCheckTicker.C
+	}
+
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-pingTicker.C:
-			err := clt.ws.WriteMessage(websocket.TextMessage, []byte("ping"))
-			if err != nil {
-				return
+			if messageType, message := clt.heartbeat.Ping(); message != nil {
+				if err := clt.writeMessage(ws, messageType, message); err != nil {
+					clt.finish(err)
+					return
+				}
 			}
-		case message, more := <-clt.messageWaitForSending:
-			if !more {
+		case <-pongCheck:
+			silence := time.Since(time.Unix(0, clt.lastPong.Load()))
+			if silence > clt.options.PingInterval+clt.options.PongTimeout {
+				clt.finish(ErrPongTimeout)
 				return
 			}
-			clt.sendMux.Lock()
-			err := clt.ws.WriteMessage(websocket.TextMessage, message)
-			clt.sendMux.Unlock()
-			if err != nil {
+		case message := <-clt.messageWaitForSending:
+			if err := clt.writeMessage(ws, websocket.TextMessage, message); err != nil {
+				clt.finish(err)
 				return
 			}
 		}
 	}
 }
 
+// watch closes the connection once the context is done, which also unblocks the reader.
+func (clt *Client) watch(ctx context.Context, ws *websocket.Conn, workers *sync.WaitGroup, done chan struct{}) {
+	<-ctx.Done()
+	clt.finish(ctx.Err())
+
+	_ = ws.Close()
+	workers.Wait()
+
+	clt.stateMux.Lock()
+	err := clt.err
+	clt.stateMux.Unlock()
+
+	if errors.Is(err, ErrClosed) {
+		clt.logger.Debug("connection closed", "address", ws.RemoteAddr().String())
+	} else {
+		clt.logger.Warn("connection lost", "address", ws.RemoteAddr().String(), "error", err)
+	}
+
+	close(done)
+}
+
+// DecodeErrors returns the number of binary frames dropped because they could not be decoded.
+func (clt *Client) DecodeErrors() uint64 {
+	return clt.decodeErrors.Load()
+}
+
+// QueueDepth returns the number of messages waiting for the handler.
+func (clt *Client) QueueDepth() int {
+	clt.stateMux.Lock()
+	queue := clt.queue
+	clt.stateMux.Unlock()
+
+	if queue == nil {
+		return 0
+	}
+
+	return queue.depth()
+}
+
+// QueueDrops returns the number of messages dropped or replaced by the overflow policy of the queue.
+func (clt *Client) QueueDrops() uint64 {
+	return clt.queueDrops.Load()
+}
+
+// IsConnected reports whether the current connection is alive, it is false before Connect and once the connection has ended.
+func (clt *Client) IsConnected() bool {
+	clt.stateMux.Lock()
+	defer clt.stateMux.Unlock()
+
+	return clt.ctx != nil && clt.ctx.Err() == nil
+}
+
 func (clt *Client) IsReading() bool {
-	return clt.isReading
+	return clt.isReading.Load()
 }
 
 func (clt *Client) IsSending() bool {
-	return clt.isSending
+	return clt.isSending.Load()
+}
+
+// Done returns a channel that is closed when the current connection has ended and all goroutines have exited.
+func (clt *Client) Done() <-chan struct{} {
+	clt.stateMux.Lock()
+	defer clt.stateMux.Unlock()
+
+	return clt.done
+}
+
+// Err returns why the current connection ended, it is nil while the connection is alive.
+func (clt *Client) Err() error {
+	clt.stateMux.Lock()
+	defer clt.stateMux.Unlock()
+
+	select {
+	case <-clt.done:
+		return clt.err
+	default:
+		return nil
+	}
 }
 
 func (clt *Client) RegisterMessageHandler(handler func([]byte)) {
@@ -88,77 +301,197 @@ func (clt *Client) RegisterMessageHandler(handler func([]byte)) {
 }
 
 func (clt *Client) SendMessage(message []byte) error {
-	if clt.isSending {
-		clt.messageWaitForSending <- message
-		return nil
+	return clt.SendMessageContext(context.Background(), message)
+}
+
+// SendMessageContext queues the message for sending, it gives up when the context is done
+// or the connection has ended.
+func (clt *Client) SendMessageContext(ctx context.Context, message []byte) error {
+	clt.stateMux.Lock()
+	connectionCtx := clt.ctx
+	clt.stateMux.Unlock()
+
+	if connectionCtx == nil {
+		return ErrClosed
+	}
+
+	select {
+	case <-connectionCtx.Done():
+		return ErrClosed
+	default:
 	}
 
-	return errors.New("client is closed")
+	select {
+	case clt.messageWaitForSending <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-connectionCtx.Done():
+		return ErrClosed
+	}
 }
 
-func (clt *Client) Connect(url string) error {
+// Connect dials the server, the connection is closed when the context is canceled.
+func (clt *Client) Connect(ctx context.Context, url string) error {
+	clt.stateMux.Lock()
+	defer clt.stateMux.Unlock()
+
 	if clt.ws != nil {
-		return errors.New("already connected")
+		return ErrAlreadyConnected
 	}
 
 	dialer := &websocket.Dialer{
-		HandshakeTimeout: 45 * time.Second,
+		HandshakeTimeout:  45 * time.Second,
+		EnableCompression: clt.options.EnableCompression,
 	}
 
 	if clt.options.SkipVerify {
 		dialer.TLSClientConfig = &tls.Config{RootCAs: nil, InsecureSkipVerify: true}
 	}
 
-	ws, _, err := dialer.Dial(url, nil)
+	if clt.options.Proxy != "" {
+		proxyURL, err := ParseProxyURL(clt.options.Proxy)
+		if err != nil {
+			return err
+		}
+
+		dialer.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	ws, _, err := dialer.DialContext(ctx, url, nil)
 	if err != nil {
 		return err
 	}
 
+	clt.lastPong.Store(time.Now().UnixNano())
+
+	ws.SetPongHandler(func(string) error {
+		clt.lastPong.Store(time.Now().UnixNano())
+		return nil
+	})
+
+	ws.SetPingHandler(func(appData string) error {
+		clt.lastPong.Store(time.Now().UnixNano())
+
+		err := ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+
+		return err
+	})
+
+	if clt.connected {
+		clt.options.Metrics.reconnected()
+	}
+
+	clt.connected = true
 	clt.ws = ws
+	clt.ctx, clt.cancel = context.WithCancel(ctx)
+	clt.readerDone = make(chan struct{})
+	clt.done = make(chan struct{})
+	clt.err = nil
+
+	// The messages left in the queue of the previous connection are discarded.
+	clt.queue = nil
+	if clt.options.Queue != nil {
+		clt.queue = newMessageQueue(clt.options.Queue, &clt.queueDrops)
+	}
+
+	var workers sync.WaitGroup
+	workers.Add(2)
+
+	go func() {
+		defer workers.Done()
+		clt.sendMessage(clt.ctx, ws)
+	}()
 
-	clt.messageWaitForSending = make(chan []byte)
+	go func() {
+		defer workers.Done()
+		clt.readMessage(clt.ctx, ws, clt.queue, clt.readerDone)
+	}()
+
+	if queue := clt.queue; queue != nil {
+		workers.Add(1)
+		go func(ctx context.Context) {
+			defer workers.Done()
+			clt.handleQueuedMessages(ctx, queue)
+		}(clt.ctx)
+	}
+
+	go clt.watch(clt.ctx, ws, &workers, clt.done)
 
-	go clt.sendMessage()
-	go clt.readMessage()
+	clt.logger.Debug("connected", "url", url)
 
 	return nil
 }
 
+// Close sends the close frame, waits for the server to acknowledge it and stops all goroutines.
 func (clt *Client) Close() error {
-	if clt.ws == nil {
+	clt.stateMux.Lock()
+	ws, readerDone, done := clt.ws, clt.readerDone, clt.done
+	clt.stateMux.Unlock()
+
+	if ws == nil {
 		return nil
 	}
 
+	clt.stateMux.Lock()
+	if clt.err == nil {
+		clt.err = ErrClosed
+	}
+	clt.stateMux.Unlock()
+
+	closeTimeout := clt.options.CloseTimeout
+	if closeTimeout <= 0 {
+		closeTimeout = 5 * time.Second
+	}
+
 	data := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
 	clt.sendMux.Lock()
-	_ = clt.ws.WriteMessage(websocket.CloseMessage, data)
+	_ = ws.WriteControl(websocket.CloseMessage, data, time.Now().Add(closeTimeout))
 	clt.sendMux.Unlock()
 
-	timeOut := time.After(time.Second * 1000)
-
-	for {
-		select {
-		case <-timeOut:
-			return errors.New("timeout")
-		default:
-			if clt.isReading || clt.isSending {
-				time.Sleep(time.Millisecond * 100)
-			} else {
-				clt.ws = nil
-				return nil
-			}
-		}
+	select {
+	case <-readerDone:
+	case <-time.After(closeTimeout):
 	}
+
+	clt.finish(ErrClosed)
+	<-done
+
+	clt.stateMux.Lock()
+	clt.ws = nil
+	clt.stateMux.Unlock()
+
+	return nil
 }
 
 func NewClient(options *Options) *Client {
 	clt := &Client{
-		options: options,
+		options:               options,
+		messageWaitForSending: make(chan []byte),
+		done:                  make(chan struct{}),
 	}
 
+	// There is no connection yet, so it is regarded as ended.
+	close(clt.done)
+
 	if clt.options.MessageHandler != nil {
 		clt.messageHandler = clt.options.MessageHandler
 	}
 
+	if clt.options.Heartbeat != nil {
+		clt.heartbeat = clt.options.Heartbeat
+	} else {
+		clt.heartbeat = &TextHeartbeat{PingText: "ping", PongText: "pong"}
+	}
+
+	if clt.options.Logger != nil {
+		clt.logger = clt.options.Logger
+	} else {
+		clt.logger = slog.Default()
+	}
+
 	return clt
 }
@@ -1,20 +1,38 @@
 package wsclt
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
+
+	"markets/pkg/exchange/exchangetest"
+	"markets/pkg/metrics"
 )
 
 func TestClient(t *testing.T) {
-	// Use OKX Public WebSocket API to test the client
-	var result []byte
+	// Use the fake OKX Public WebSocket API to test the client
+	server := exchangetest.NewOkxServer()
+	defer server.Close()
+
+	results := make(chan []byte, 16)
 
 	messageHandler := func(msg []byte) {
-		if result == nil {
-			result = msg
-		}
+		results <- msg
 	}
 
 	clt := NewClient(&Options{
@@ -23,12 +41,12 @@ func TestClient(t *testing.T) {
 		MessageHandler: messageHandler,
 	})
 
-	err := clt.Connect("wss://ws.okx.com:8443/ws/v5/public")
+	err := clt.Connect(context.Background(), server.URL+"/ws/v5/public")
 	if err != nil {
 		t.Errorf("Connect error: %v", err)
 	}
 
-	err = clt.Connect("wss://ws.okx.com:8443/ws/v5/public")
+	err = clt.Connect(context.Background(), server.URL+"/ws/v5/public")
 	if err.Error() != "already connected" {
 		t.Errorf("Connection state check error: %v", err)
 	}
@@ -51,11 +69,11 @@ func TestClient(t *testing.T) {
 		}
 	}
 
-	for {
-		if result != nil {
-			break
-		}
-		<-time.After(time.Second)
+	var result []byte
+	select {
+	case result = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the subscription")
 	}
 
 	var decodedMsg map[string]interface{}
@@ -81,3 +99,518 @@ func TestClient(t *testing.T) {
 		t.Errorf("Close failed")
 	}
 }
+
+func newEchoServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_Lifecycle(t *testing.T) {
+	server := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	received := make(chan []byte, 1)
+	clientMetrics := &Metrics{
+		MessagesIn:  &metrics.Counter{},
+		BytesIn:     &metrics.Counter{},
+		MessagesOut: &metrics.Counter{},
+		BytesOut:    &metrics.Counter{},
+		Reconnects:  &metrics.Counter{},
+	}
+	clt := NewClient(&Options{
+		PingInterval: time.Hour,
+		MessageHandler: func(msg []byte) {
+			received <- msg
+		},
+		Metrics: clientMetrics,
+	})
+
+	if err := clt.SendMessage([]byte("hello")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed before connecting, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := clt.Connect(ctx, url); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	if err := clt.SendMessage([]byte("hello")); err != nil {
+		t.Errorf("SendMessage error: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg) != "hello" {
+			t.Errorf("Expected echo 'hello', got '%s'", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Echo message is not received")
+	}
+
+	if err := clt.Err(); err != nil {
+		t.Errorf("Expected no error while connected, got %v", err)
+	}
+
+	if !clt.IsConnected() {
+		t.Errorf("Expected the client to be connected")
+	}
+
+	if clientMetrics.MessagesOut.Value() != 1 || clientMetrics.BytesOut.Value() != 5 ||
+		clientMetrics.MessagesIn.Value() != 1 || clientMetrics.BytesIn.Value() != 5 {
+		t.Errorf("Metrics Error: expected one message of 5 bytes in each direction, got %v %v %v %v",
+			clientMetrics.MessagesOut.Value(), clientMetrics.BytesOut.Value(),
+			clientMetrics.MessagesIn.Value(), clientMetrics.BytesIn.Value())
+	}
+
+	// Canceling the context should end the connection.
+	cancel()
+
+	select {
+	case <-clt.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Connection is not ended after canceling the context")
+	}
+
+	if !errors.Is(clt.Err(), context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", clt.Err())
+	}
+
+	if clt.IsConnected() {
+		t.Errorf("Expected the client not to be connected after the connection ended")
+	}
+
+	if err := clt.SendMessage([]byte("hello")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after the connection ended, got %v", err)
+	}
+
+	if err := clt.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+
+	// The client can be connected again after closing.
+	if err := clt.Connect(context.Background(), url); err != nil {
+		t.Fatalf("Reconnect error: %v", err)
+	}
+
+	deadlineCtx, deadlineCancel := context.WithTimeout(context.Background(), time.Second)
+	defer deadlineCancel()
+
+	if err := clt.SendMessageContext(deadlineCtx, []byte("hello again")); err != nil {
+		t.Errorf("SendMessageContext error: %v", err)
+	}
+
+	if clientMetrics.Reconnects.Value() != 1 {
+		t.Errorf("Metrics Error: expected 1 reconnect, got %v", clientMetrics.Reconnects.Value())
+	}
+
+	if err := clt.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+
+	if !errors.Is(clt.Err(), ErrClosed) {
+		t.Errorf("Expected ErrClosed after closing, got %v", clt.Err())
+	}
+}
+
+func TestClient_Heartbeat(t *testing.T) {
+	server := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	heartbeats := map[string]Heartbeat{
+		// The echo server sends the ping back, so the ping itself is the pong.
+		"text": &TextHeartbeat{PingText: "ping", PongText: "ping"},
+		"json": &JSONHeartbeat{
+			Build: func() []byte {
+				return []byte(`{"channel":"spot.ping"}`)
+			},
+			IsPongMessage: func(message []byte) bool {
+				return strings.Contains(string(message), "spot.ping")
+			},
+		},
+		"control": &ControlFrameHeartbeat{},
+	}
+
+	for name, heartbeat := range heartbeats {
+		clt := NewClient(&Options{
+			PingInterval: 20 * time.Millisecond,
+			PongTimeout:  100 * time.Millisecond,
+			Heartbeat:    heartbeat,
+			MessageHandler: func(msg []byte) {
+				t.Errorf("%s heartbeat: The pong should not be passed to the handler, got '%s'", name, msg)
+			},
+		})
+
+		if err := clt.Connect(context.Background(), url); err != nil {
+			t.Fatalf("Connect error: %v", err)
+		}
+
+		select {
+		case <-clt.Done():
+			t.Errorf("%s heartbeat: The connection should be kept alive, but ended with %v", name, clt.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		if err := clt.Close(); err != nil {
+			t.Errorf("Close error: %v", err)
+		}
+	}
+}
+
+func TestClient_PongTimeout(t *testing.T) {
+	// The echo server sends "ping" back, which never matches the expected pong.
+	server := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	clt := NewClient(&Options{
+		PingInterval: 20 * time.Millisecond,
+		PongTimeout:  100 * time.Millisecond,
+		Heartbeat:    &TextHeartbeat{PingText: "ping", PongText: "pong"},
+	})
+
+	if err := clt.Connect(context.Background(), url); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	select {
+	case <-clt.Done():
+		if !errors.Is(clt.Err(), ErrPongTimeout) {
+			t.Errorf("Expected ErrPongTimeout, got %v", clt.Err())
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("The silent connection is not declared dead")
+	}
+
+	if err := clt.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+}
+
+func TestClient_ServerPing(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	replies := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"ping":1}`)); err != nil {
+			return
+		}
+
+		if _, message, err := conn.ReadMessage(); err == nil {
+			replies <- string(message)
+		}
+	}))
+	defer server.Close()
+
+	clt := NewClient(&Options{
+		PingInterval: time.Hour,
+		Heartbeat: &ServerPingHeartbeat{
+			IsPing: func(message []byte) bool {
+				return strings.Contains(string(message), "ping")
+			},
+			BuildPong: func(ping []byte) []byte {
+				return []byte(strings.Replace(string(ping), "ping", "pong", 1))
+			},
+		},
+	})
+
+	if err := clt.Connect(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	select {
+	case reply := <-replies:
+		if reply != `{"pong":1}` {
+			t.Errorf("Expected reply '{\"pong\":1}', got '%s'", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("The server ping is not replied")
+	}
+
+	if err := clt.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+}
+
+func TestClient_Compression(t *testing.T) {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		_, _ = writer.Write([]byte("compressed message"))
+		_ = writer.Close()
+
+		_ = conn.WriteMessage(websocket.BinaryMessage, []byte("corrupted"))
+		_ = conn.WriteMessage(websocket.BinaryMessage, buffer.Bytes())
+		_ = conn.WriteMessage(websocket.TextMessage, []byte("plain message"))
+
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	received := make(chan string, 2)
+	clt := NewClient(&Options{
+		PingInterval:      time.Hour,
+		EnableCompression: true,
+		Decoder:           DecodeGzip,
+		MessageHandler: func(msg []byte) {
+			received <- string(msg)
+		},
+	})
+
+	if err := clt.Connect(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	for _, expected := range []string{"compressed message", "plain message"} {
+		select {
+		case msg := <-received:
+			if msg != expected {
+				t.Errorf("Expected '%s', got '%s'", expected, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Message '%s' is not received", expected)
+		}
+	}
+
+	if clt.DecodeErrors() != 1 {
+		t.Errorf("Expected 1 decode error, got %d", clt.DecodeErrors())
+	}
+
+	if err := clt.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+}
+
+func TestClient_RecordAndReplay(t *testing.T) {
+	server := newEchoServer(t)
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	recorder, err := NewFileRecorder(path)
+	if err != nil {
+		t.Fatalf("NewFileRecorder error: %v", err)
+	}
+
+	received := make(chan []byte, 1)
+	clt := NewClient(&Options{
+		PingInterval: time.Hour,
+		Recorder:     recorder,
+		MessageHandler: func(msg []byte) {
+			received <- msg
+		},
+	})
+
+	if err := clt.Connect(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	if err := clt.SendMessage([]byte("recorded")); err != nil {
+		t.Errorf("SendMessage error: %v", err)
+	}
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Echo message is not received")
+	}
+
+	if err := clt.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+
+	if err := recorder.Close(); err != nil {
+		t.Errorf("Recorder Close error: %v", err)
+	}
+
+	var replayed []string
+	replayer := &Replayer{Speed: 100}
+	if err := replayer.PlayFile(context.Background(), path, func(msg []byte) {
+		replayed = append(replayed, string(msg))
+	}); err != nil {
+		t.Errorf("PlayFile error: %v", err)
+	}
+
+	// Only the inbound frames are replayed.
+	if !reflect.DeepEqual(replayed, []string{"recorded"}) {
+		t.Errorf("Expected replayed messages to be [recorded], got %v", replayed)
+	}
+}
+
+func TestReplayer_Heartbeat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	recorder, err := NewFileRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.Record(DirectionInbound, websocket.TextMessage, []byte("pong"))
+	recorder.Record(DirectionInbound, websocket.TextMessage, []byte("update"))
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed []string
+	replayer := &Replayer{Heartbeat: &TextHeartbeat{PingText: "ping", PongText: "pong"}}
+	if err := replayer.PlayFile(context.Background(), path, func(msg []byte) {
+		replayed = append(replayed, string(msg))
+	}); err != nil {
+		t.Errorf("PlayFile error: %v", err)
+	}
+
+	// The pongs are skipped as the client does.
+	if !reflect.DeepEqual(replayed, []string{"update"}) {
+		t.Errorf("Expected replayed messages to be [update], got %v", replayed)
+	}
+}
+
+func TestReplayer_HeartbeatDecoded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	recorder, err := NewFileRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, message := range []string{"pong", "update"} {
+		var buffer bytes.Buffer
+		writer, _ := flate.NewWriter(&buffer, flate.DefaultCompression)
+		_, _ = writer.Write([]byte(message))
+		_ = writer.Close()
+
+		recorder.Record(DirectionInbound, websocket.BinaryMessage, buffer.Bytes())
+	}
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed []string
+	replayer := &Replayer{
+		Decoder:   DecodeDeflate,
+		Heartbeat: &TextHeartbeat{PingText: "ping", PongText: "pong"},
+	}
+	if err := replayer.PlayFile(context.Background(), path, func(msg []byte) {
+		replayed = append(replayed, string(msg))
+	}); err != nil {
+		t.Errorf("PlayFile error: %v", err)
+	}
+
+	// The decompressed pongs are texts, so they are skipped as well.
+	if !reflect.DeepEqual(replayed, []string{"update"}) {
+		t.Errorf("Expected replayed messages to be [update], got %v", replayed)
+	}
+}
+
+func TestClient_Proxy(t *testing.T) {
+	server := newEchoServer(t)
+	tunnels := make(chan string, 1)
+
+	// A minimal HTTP CONNECT proxy requiring the basic authentication.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:password"))
+		if r.Method != http.MethodConnect || r.Header.Get("Proxy-Authorization") != expectedAuth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = target.Close()
+			return
+		}
+
+		tunnels <- r.Host
+
+		go func() {
+			_, _ = io.Copy(target, conn)
+			_ = target.Close()
+		}()
+		_, _ = io.Copy(conn, target)
+		_ = conn.Close()
+	}))
+	defer proxy.Close()
+
+	received := make(chan []byte, 1)
+	clt := NewClient(&Options{
+		PingInterval: time.Hour,
+		Proxy:        "http://user:password@" + strings.TrimPrefix(proxy.URL, "http://"),
+		MessageHandler: func(msg []byte) {
+			received <- msg
+		},
+	})
+
+	if err := clt.Connect(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	select {
+	case host := <-tunnels:
+		if host != strings.TrimPrefix(server.URL, "http://") {
+			t.Errorf("Expected tunnel to %s, got %s", server.URL, host)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("The connection does not go through the proxy")
+	}
+
+	if err := clt.SendMessage([]byte("proxied")); err != nil {
+		t.Errorf("SendMessage error: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg) != "proxied" {
+			t.Errorf("Expected echo 'proxied', got '%s'", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Echo message is not received")
+	}
+
+	if err := clt.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+
+	if _, err := ParseProxyURL("ftp://127.0.0.1:21"); err == nil {
+		t.Errorf("Expected the unsupported proxy scheme to be rejected")
+	}
+}
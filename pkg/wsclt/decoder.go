@@ -0,0 +1,42 @@
+package wsclt
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+// Decoder decompresses the payload of the binary frames before they are handled.
+type Decoder func(message []byte) ([]byte, error)
+
+// DecodeGzip decompresses the gzip compressed payloads.
+func DecodeGzip(message []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// DecodeDeflate decompresses the raw deflate compressed payloads without the zlib header.
+func DecodeDeflate(message []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(message))
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// DecodeZlib decompresses the deflate compressed payloads with the zlib header.
+func DecodeZlib(message []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,92 @@
+package wsclt
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+// Heartbeat describes how the client keeps the connection alive.
+// The client sends the ping on every PingInterval, the pongs and the server pings are
+// regarded as signs of life and are not passed to the message handler.
+type Heartbeat interface {
+	// Ping returns the message to send, a nil message means the client never sends pings.
+	Ping() (messageType int, message []byte)
+	// IsPong reports whether the received message is the pong of the ping.
+	IsPong(messageType int, message []byte) bool
+	// Reply returns the reply if the received message is a ping sent by the server.
+	Reply(messageType int, message []byte) ([]byte, bool)
+}
+
+// TextHeartbeat sends a plain text ping and expects a plain text pong, e.g. "ping" and "pong" for OKX.
+type TextHeartbeat struct {
+	PingText string
+	PongText string
+}
+
+func (h *TextHeartbeat) Ping() (int, []byte) {
+	return websocket.TextMessage, []byte(h.PingText)
+}
+
+func (h *TextHeartbeat) IsPong(messageType int, message []byte) bool {
+	return messageType == websocket.TextMessage && string(message) == h.PongText
+}
+
+func (h *TextHeartbeat) Reply(_ int, _ []byte) ([]byte, bool) {
+	return nil, false
+}
+
+// JSONHeartbeat sends the JSON ping built on every interval, e.g. the spot.ping channel of Gate.io.
+type JSONHeartbeat struct {
+	Build         func() []byte
+	IsPongMessage func(message []byte) bool
+}
+
+func (h *JSONHeartbeat) Ping() (int, []byte) {
+	return websocket.TextMessage, h.Build()
+}
+
+func (h *JSONHeartbeat) IsPong(messageType int, message []byte) bool {
+	return messageType == websocket.TextMessage && h.IsPongMessage(message)
+}
+
+func (h *JSONHeartbeat) Reply(_ int, _ []byte) ([]byte, bool) {
+	return nil, false
+}
+
+// ControlFrameHeartbeat sends the ping frames defined by the WebSocket protocol.
+// The pong frames are handled by the client directly.
+type ControlFrameHeartbeat struct{}
+
+func (h *ControlFrameHeartbeat) Ping() (int, []byte) {
+	return websocket.PingMessage, []byte{}
+}
+
+func (h *ControlFrameHeartbeat) IsPong(_ int, _ []byte) bool {
+	return false
+}
+
+func (h *ControlFrameHeartbeat) Reply(_ int, _ []byte) ([]byte, bool) {
+	return nil, false
+}
+
+// ServerPingHeartbeat never sends pings, it replies the pings sent by the server instead.
+// PingInterval is regarded as the interval of the server pings.
+type ServerPingHeartbeat struct {
+	IsPing    func(message []byte) bool
+	BuildPong func(ping []byte) []byte
+}
+
+func (h *ServerPingHeartbeat) Ping() (int, []byte) {
+	return 0, nil
+}
+
+func (h *ServerPingHeartbeat) IsPong(_ int, _ []byte) bool {
+	return false
+}
+
+func (h *ServerPingHeartbeat) Reply(messageType int, message []byte) ([]byte, bool) {
+	if messageType != websocket.TextMessage || !h.IsPing(message) {
+		return nil, false
+	}
+
+	return h.BuildPong(message), true
+}
@@ -0,0 +1,43 @@
+package wsclt
+
+import "markets/pkg/metrics"
+
+// Metrics counts the traffic of the connections, the counters are shared by the connections of a pool.
+// A nil counter is not counted.
+type Metrics struct {
+	// MessagesIn and BytesIn count every data frame read, including the heartbeats.
+	MessagesIn *metrics.Counter
+	BytesIn    *metrics.Counter
+	// MessagesOut and BytesOut count every data frame written, including the heartbeats.
+	MessagesOut *metrics.Counter
+	BytesOut    *metrics.Counter
+	// Reconnects counts the connections opened again by Connect after the previous one ended,
+	// and the lost connections of a pool whose topics are subscribed again.
+	Reconnects *metrics.Counter
+}
+
+func (m *Metrics) received(message []byte) {
+	if m == nil {
+		return
+	}
+
+	m.MessagesIn.Inc()
+	m.BytesIn.Add(float64(len(message)))
+}
+
+func (m *Metrics) sent(message []byte) {
+	if m == nil {
+		return
+	}
+
+	m.MessagesOut.Inc()
+	m.BytesOut.Add(float64(len(message)))
+}
+
+func (m *Metrics) reconnected() {
+	if m == nil {
+		return
+	}
+
+	m.Reconnects.Inc()
+}
@@ -0,0 +1,491 @@
+package wsclt
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type PoolOptions struct {
+	// Options is the template of the options of every connection,
+	// the message handler receives the messages of all connections one at a time.
+	Options
+	// MaxTopicsPerConnection is the maximum number of topics subscribed on a single connection.
+	MaxTopicsPerConnection int
+	// BuildSubscribe builds the messages subscribing the topics on a connection.
+	BuildSubscribe func(topics []string) ([][]byte, error)
+	// BuildUnsubscribe builds the messages unsubscribing the topics on a connection, it is required by Unsubscribe.
+	BuildUnsubscribe func(topics []string) ([][]byte, error)
+	// ReconnectDelay is the delay before the topics of a dead connection are subscribed again, 1 second by default.
+	ReconnectDelay time.Duration
+}
+
+type poolShard struct {
+	client *Client
+	topics []string
+}
+
+// Pool shards the subscriptions across multiple connections to the same server.
+// The topics of a dead connection are redistributed to the connections with spare capacity,
+// new connections are opened if there is not enough capacity.
+type Pool struct {
+	options *PoolOptions
+	url     string
+
+	handlerMux sync.Mutex
+
+	mux    sync.Mutex
+	shards []*poolShard
+	// orphans are the topics of the dead connections waiting to be subscribed again.
+	orphans map[string]bool
+	// connecting are the topics waiting for their new connection to be opened.
+	connecting map[string]bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	closed     bool
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+func (p *Pool) handleMessage(message []byte) {
+	p.handlerMux.Lock()
+	defer p.handlerMux.Unlock()
+
+	if p.options.MessageHandler != nil {
+		p.options.MessageHandler(message)
+	}
+}
+
+// dial opens a new connection, it is called without the lock because connecting may take a while.
+func (p *Pool) dial(ctx context.Context) (*Client, error) {
+	options := p.options.Options
+	options.MessageHandler = p.handleMessage
+
+	clt := NewClient(&options)
+	if err := clt.Connect(ctx, p.url); err != nil {
+		return nil, err
+	}
+
+	return clt, nil
+}
+
+// addShard adds the connection with the topics to the pool and watches it, it must be called with the lock held.
+func (p *Pool) addShard(clt *Client, topics []string) *poolShard {
+	shard := &poolShard{client: clt, topics: topics}
+	p.shards = append(p.shards, shard)
+
+	p.wg.Add(1)
+	go p.watch(shard)
+
+	return shard
+}
+
+// sendSubscribe sends the messages subscribing the topics on the connection of the shard.
+func (p *Pool) sendSubscribe(ctx context.Context, shard *poolShard, topics []string) error {
+	messages, err := p.options.BuildSubscribe(topics)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := shard.client.SendMessageContext(ctx, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// watch resubscribes the topics of the shard once its connection is dead.
+func (p *Pool) watch(shard *poolShard) {
+	defer p.wg.Done()
+
+	<-shard.client.Done()
+
+	p.mux.Lock()
+	for index, value := range p.shards {
+		if value == shard {
+			p.shards = append(p.shards[:index], p.shards[index+1:]...)
+			break
+		}
+	}
+	topics := shard.topics
+	for _, topic := range topics {
+		p.orphans[topic] = true
+	}
+	p.mux.Unlock()
+
+	_ = shard.client.Close()
+
+	if len(topics) > 0 {
+		p.options.logger().Warn("resubscribing the topics of the lost connection", "topics", len(topics))
+	}
+
+	p.resubscribe(topics)
+}
+
+// resubscribe subscribes the orphaned topics again until it succeeds or the pool is closed.
+func (p *Pool) resubscribe(topics []string) {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(p.options.ReconnectDelay):
+		}
+
+		// The topics unsubscribed in the meantime are not subscribed again.
+		p.mux.Lock()
+		var pending []string
+		for _, topic := range topics {
+			if p.orphans[topic] {
+				pending = append(pending, topic)
+			}
+		}
+		p.mux.Unlock()
+
+		if len(pending) == 0 {
+			return
+		}
+
+		if err := p.subscribe(pending, false); err == nil {
+			p.options.Metrics.reconnected()
+			return
+		} else {
+			p.options.logger().Warn("can't resubscribe the topics", "topics", len(pending), "error", err)
+		}
+	}
+}
+
+// Subscribe assigns the topics which are not subscribed yet to the connections and subscribes them.
+// The topics left without a connection because it can't be opened are retried in background.
+func (p *Pool) Subscribe(topics ...string) error {
+	return p.subscribe(topics, true)
+}
+
+// subscribe fills the spare capacity of the connections first and opens new connections for the rest,
+// the connections are opened and the messages are sent without the lock so the pool can still be inspected.
+// The topics which can't be placed are orphaned, they are retried in background if retry is set,
+// otherwise the caller retries them.
+func (p *Pool) subscribe(topics []string, retry bool) error {
+	p.mux.Lock()
+
+	if p.ctx == nil || p.ctx.Err() != nil {
+		p.mux.Unlock()
+		return ErrClosed
+	}
+
+	ctx := p.ctx
+
+	subscribed := make(map[string]bool)
+	for _, shard := range p.shards {
+		for _, topic := range shard.topics {
+			subscribed[topic] = true
+		}
+	}
+	for topic := range p.connecting {
+		subscribed[topic] = true
+	}
+
+	assigned := make(map[*poolShard][]string)
+	var unplaced []string
+
+	for _, topic := range topics {
+		if subscribed[topic] {
+			continue
+		}
+		subscribed[topic] = true
+
+		// Fill the least loaded connection first.
+		var target *poolShard
+		for _, shard := range p.shards {
+			if len(shard.topics) < p.options.MaxTopicsPerConnection &&
+				(target == nil || len(shard.topics) < len(target.topics)) {
+				target = shard
+			}
+		}
+
+		if target == nil {
+			// The topic is reserved while its connection is opened, so it is not subscribed twice.
+			unplaced = append(unplaced, topic)
+			p.connecting[topic] = true
+			continue
+		}
+
+		target.topics = append(target.topics, topic)
+		assigned[target] = append(assigned[target], topic)
+		delete(p.orphans, topic)
+	}
+
+	p.mux.Unlock()
+
+	var firstErr error
+	for shard, shardTopics := range assigned {
+		if err := p.sendSubscribe(ctx, shard, shardTopics); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for len(unplaced) > 0 {
+		size := p.options.MaxTopicsPerConnection
+		if size > len(unplaced) {
+			size = len(unplaced)
+		}
+		clt, err := p.dial(ctx)
+
+		p.mux.Lock()
+		// The pool may have been closed, or even connected again, while the connection was opened.
+		current := p.ctx == ctx && ctx.Err() == nil
+		if err == nil && !current {
+			err = ErrClosed
+		}
+
+		if err != nil {
+			if clt != nil {
+				_ = clt.Close()
+			}
+
+			if current {
+				// The orphans are subscribed again later, the pool is not regarded as connected until then.
+				for _, topic := range unplaced {
+					if p.connecting[topic] {
+						delete(p.connecting, topic)
+						p.orphans[topic] = true
+					}
+				}
+
+				if retry {
+					p.wg.Add(1)
+					go func(topics []string) {
+						defer p.wg.Done()
+						p.resubscribe(topics)
+					}(unplaced)
+				}
+			}
+			p.mux.Unlock()
+
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+
+		// The topics unsubscribed in the meantime are not subscribed.
+		var kept []string
+		for _, topic := range unplaced[:size] {
+			if p.connecting[topic] {
+				kept = append(kept, topic)
+				delete(p.connecting, topic)
+				delete(p.orphans, topic)
+			}
+		}
+		shard := p.addShard(clt, kept)
+		p.mux.Unlock()
+
+		unplaced = unplaced[size:]
+
+		if len(kept) == 0 {
+			continue
+		}
+
+		if err := p.sendSubscribe(ctx, shard, kept); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Unsubscribe unsubscribes the topics from the connections they are assigned to,
+// the connections are kept open even if they have no topics left.
+func (p *Pool) Unsubscribe(topics ...string) error {
+	if p.options.BuildUnsubscribe == nil {
+		return errors.New("no unsubscribe message builder")
+	}
+
+	p.mux.Lock()
+
+	if p.ctx == nil || p.ctx.Err() != nil {
+		p.mux.Unlock()
+		return ErrClosed
+	}
+
+	ctx := p.ctx
+
+	removing := make(map[string]bool)
+	for _, topic := range topics {
+		removing[topic] = true
+		delete(p.orphans, topic)
+		delete(p.connecting, topic)
+	}
+
+	removed := make(map[*poolShard][]string)
+	for _, shard := range p.shards {
+		kept := shard.topics[:0]
+		for _, topic := range shard.topics {
+			if removing[topic] {
+				removed[shard] = append(removed[shard], topic)
+			} else {
+				kept = append(kept, topic)
+			}
+		}
+		shard.topics = kept
+	}
+
+	p.mux.Unlock()
+
+	// The messages are sent without the lock so the pool can still be inspected.
+	for shard, shardTopics := range removed {
+		messages, err := p.options.BuildUnsubscribe(shardTopics)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			if err := shard.client.SendMessageContext(ctx, message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SendMessage sends the message on every connection of the pool.
+func (p *Pool) SendMessage(message []byte) error {
+	p.mux.Lock()
+	if p.ctx == nil || p.ctx.Err() != nil {
+		p.mux.Unlock()
+		return ErrClosed
+	}
+
+	ctx := p.ctx
+	shards := append([]*poolShard(nil), p.shards...)
+	p.mux.Unlock()
+
+	for _, shard := range shards {
+		if err := shard.client.SendMessageContext(ctx, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Topics returns the topics subscribed on every connection.
+func (p *Pool) Topics() [][]string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	topics := make([][]string, 0, len(p.shards))
+	for _, shard := range p.shards {
+		topics = append(topics, append([]string(nil), shard.topics...))
+	}
+
+	return topics
+}
+
+// IsConnected reports whether the pool is open and every subscribed topic is on a live connection,
+// it is false while the topics of a lost connection wait to be subscribed again or a new connection is opened.
+func (p *Pool) IsConnected() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.ctx == nil || p.closed || len(p.orphans) > 0 || len(p.connecting) > 0 {
+		return false
+	}
+
+	for _, shard := range p.shards {
+		if !shard.client.IsConnected() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Connect prepares the pool, the connections are opened on demand by Subscribe.
+func (p *Pool) Connect(ctx context.Context, url string) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.ctx != nil && !p.closed {
+		return ErrAlreadyConnected
+	}
+
+	p.url = url
+	p.closed = false
+	p.orphans = make(map[string]bool)
+	p.connecting = make(map[string]bool)
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+
+	return nil
+}
+
+// Done returns a channel that is closed when the pool is closed.
+func (p *Pool) Done() <-chan struct{} {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return p.done
+}
+
+func (p *Pool) Close() error {
+	p.mux.Lock()
+	if p.ctx == nil || p.closed {
+		p.mux.Unlock()
+		return nil
+	}
+
+	p.closed = true
+	p.cancel()
+	shards := p.shards
+	p.shards = nil
+	p.mux.Unlock()
+
+	var firstErr error
+	for _, shard := range shards {
+		if err := shard.client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	p.wg.Wait()
+	close(p.done)
+
+	return firstErr
+}
+
+func (o *PoolOptions) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+
+	return slog.Default()
+}
+
+func NewPool(options *PoolOptions) (*Pool, error) {
+	if options.MaxTopicsPerConnection <= 0 {
+		return nil, errors.New("the maximum number of topics per connection must be positive")
+	}
+
+	if options.BuildSubscribe == nil {
+		return nil, errors.New("no subscribe message builder")
+	}
+
+	if options.ReconnectDelay <= 0 {
+		options.ReconnectDelay = time.Second
+	}
+
+	p := &Pool{
+		options: options,
+		done:    make(chan struct{}),
+	}
+
+	// There is no connection yet, so it is regarded as closed.
+	close(p.done)
+
+	return p, nil
+}
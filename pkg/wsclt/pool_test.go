@@ -0,0 +1,316 @@
+package wsclt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"markets/pkg/metrics"
+)
+
+func TestPool(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	var connsMux sync.Mutex
+	var conns []*websocket.Conn
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		connsMux.Lock()
+		conns = append(conns, conn)
+		connsMux.Unlock()
+
+		// Acknowledge every subscription so the messages of all connections reach the handler.
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := conn.WriteMessage(websocket.TextMessage, append([]byte("ack:"), message...)); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	var acksMux sync.Mutex
+	acks := make(map[string]bool)
+
+	reconnects := &metrics.Counter{}
+
+	pool, err := NewPool(&PoolOptions{
+		Options: Options{
+			PingInterval: time.Hour,
+			Metrics:      &Metrics{Reconnects: reconnects},
+			MessageHandler: func(msg []byte) {
+				acksMux.Lock()
+				for _, topic := range strings.Split(strings.TrimPrefix(string(msg), "ack:"), ",") {
+					acks[topic] = true
+				}
+				acksMux.Unlock()
+			},
+		},
+		MaxTopicsPerConnection: 2,
+		ReconnectDelay:         10 * time.Millisecond,
+		BuildSubscribe: func(topics []string) ([][]byte, error) {
+			return [][]byte{[]byte(strings.Join(topics, ","))}, nil
+		},
+		BuildUnsubscribe: func(topics []string) ([][]byte, error) {
+			return [][]byte{[]byte("-" + strings.Join(topics, ",-"))}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPool error: %v", err)
+	}
+
+	if err := pool.Connect(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	if err := pool.Subscribe("a", "b", "c", "d", "e", "a"); err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+
+	checkTopics := func(expectedConnections int) {
+		topics := pool.Topics()
+
+		var all []string
+		for _, shardTopics := range topics {
+			if len(shardTopics) > 2 {
+				t.Errorf("Expected at most 2 topics per connection, got %v", shardTopics)
+			}
+			all = append(all, shardTopics...)
+		}
+
+		sort.Strings(all)
+		if strings.Join(all, ",") != "a,b,c,d,e" {
+			t.Errorf("Expected topics a,b,c,d,e, got %v", topics)
+		}
+
+		if len(topics) != expectedConnections {
+			t.Errorf("Expected %d connections, got %d", expectedConnections, len(topics))
+		}
+	}
+
+	checkTopics(3)
+
+	if !pool.IsConnected() {
+		t.Errorf("Expected the pool to be connected")
+	}
+
+	waitForAcks := func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			acksMux.Lock()
+			count := len(acks)
+			acksMux.Unlock()
+
+			if count == 5 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("Expected the acknowledgements of 5 topics, got %v", acks)
+	}
+
+	waitForAcks()
+
+	// Kill the first connection on the server side, its topics should be subscribed again.
+	acksMux.Lock()
+	acks = make(map[string]bool)
+	acks["c"], acks["d"], acks["e"] = true, true, true
+	acksMux.Unlock()
+
+	connsMux.Lock()
+	_ = conns[0].Close()
+	connsMux.Unlock()
+
+	waitForAcks()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for reconnects.Value() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if reconnects.Value() != 1 {
+		t.Errorf("Expected 1 reconnect, got %v", reconnects.Value())
+	}
+
+	// The topics of the dead connection fill the spare capacity before a new connection is opened.
+	checkTopics(3)
+
+	acksMux.Lock()
+	acks = make(map[string]bool)
+	acksMux.Unlock()
+
+	if err := pool.Unsubscribe("a", "c", "x"); err != nil {
+		t.Fatalf("Unsubscribe error: %v", err)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		acksMux.Lock()
+		done := acks["-a"] && acks["-c"]
+		acksMux.Unlock()
+
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var remaining []string
+	for _, shardTopics := range pool.Topics() {
+		remaining = append(remaining, shardTopics...)
+	}
+	sort.Strings(remaining)
+
+	acksMux.Lock()
+	if strings.Join(remaining, ",") != "b,d,e" || !acks["-a"] || !acks["-c"] || acks["-x"] {
+		t.Errorf("Unsubscribe Error: remaining %v, acknowledgements %v", remaining, acks)
+	}
+	acksMux.Unlock()
+
+	if err := pool.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+
+	select {
+	case <-pool.Done():
+	default:
+		t.Errorf("Done should be closed after closing the pool")
+	}
+
+	if pool.IsConnected() {
+		t.Errorf("Expected the pool not to be connected after closing it")
+	}
+
+	if err := pool.Subscribe("f"); err == nil {
+		t.Errorf("Expected Subscribe to fail after closing the pool")
+	}
+}
+
+func TestPool_SubscribeError(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	// The handshakes are held until release is closed and refused until accept is set.
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var accept atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		<-release
+
+		if !accept.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	pool, err := NewPool(&PoolOptions{
+		Options:                Options{PingInterval: time.Hour},
+		MaxTopicsPerConnection: 2,
+		ReconnectDelay:         10 * time.Millisecond,
+		BuildSubscribe: func(topics []string) ([][]byte, error) {
+			return [][]byte{[]byte(strings.Join(topics, ","))}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPool error: %v", err)
+	}
+
+	if err := pool.Connect(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	defer pool.Close()
+
+	subscribed := make(chan error, 1)
+	go func() {
+		subscribed <- pool.Subscribe("a", "b", "c")
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The connection is not opened")
+	}
+
+	// The pool can be inspected while the connection is opened.
+	inspected := make(chan bool, 1)
+	go func() {
+		_ = pool.Topics()
+		inspected <- pool.IsConnected()
+	}()
+
+	select {
+	case connected := <-inspected:
+		if connected {
+			t.Error("Expected the pool not to be connected while the connection is opened")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The pool is locked while the connection is opened")
+	}
+
+	close(release)
+
+	select {
+	case err := <-subscribed:
+		if err == nil {
+			t.Error("Expected Subscribe to fail when the connection is refused")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe did not return")
+	}
+
+	if pool.IsConnected() {
+		t.Error("Expected the pool not to be connected while the topics wait to be subscribed")
+	}
+
+	// The topics which were not subscribed are retried once the server accepts the connections.
+	accept.Store(true)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !pool.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var all []string
+	for _, shardTopics := range pool.Topics() {
+		all = append(all, shardTopics...)
+	}
+	sort.Strings(all)
+
+	if !pool.IsConnected() || strings.Join(all, ",") != "a,b,c" {
+		t.Errorf("Expected topics a,b,c to be subscribed again, got %v", pool.Topics())
+	}
+}
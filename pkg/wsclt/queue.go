@@ -0,0 +1,168 @@
+package wsclt
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens when a message arrives and the queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading from the connection until the handler catches up.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued message to make room for the new one.
+	OverflowDropOldest
+	// OverflowCoalesce replaces the queued message with the same key, e.g. the same instrument,
+	// so only the latest message of every key is handled. The oldest message is dropped if the
+	// key is not queued yet and the queue is full.
+	OverflowCoalesce
+)
+
+// QueueOptions places a bounded queue between the reader and the message handler,
+// so a slow handler does not stall reading the connection.
+// Dropping or coalescing messages only suits the streams of snapshots, the incremental
+// updates of an order book must not be dropped.
+type QueueOptions struct {
+	// Size is the maximum number of queued messages, 1024 by default.
+	Size int
+	// Policy is OverflowBlock by default.
+	Policy OverflowPolicy
+	// CoalesceKey returns the key of the message for OverflowCoalesce,
+	// the messages with an empty key are never coalesced.
+	CoalesceKey func(message []byte) string
+}
+
+type queueEntry struct {
+	key     string
+	message []byte
+}
+
+// messageQueue is a bounded FIFO with a single producer, the reader, and a single consumer, the worker.
+type messageQueue struct {
+	options *QueueOptions
+	dropped *atomic.Uint64
+
+	mux     sync.Mutex
+	entries []*queueEntry
+	keys    map[string]*queueEntry
+
+	// ready and space are notified when a message is pushed or popped respectively.
+	ready chan struct{}
+	space chan struct{}
+}
+
+func notify(signal chan struct{}) {
+	select {
+	case signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *messageQueue) size() int {
+	if q.options.Size > 0 {
+		return q.options.Size
+	}
+
+	return 1024
+}
+
+// dropOldest must be called with the lock held.
+func (q *messageQueue) dropOldest() {
+	oldest := q.entries[0]
+	q.entries = q.entries[1:]
+	if q.keys[oldest.key] == oldest {
+		delete(q.keys, oldest.key)
+	}
+
+	q.dropped.Add(1)
+}
+
+// push queues the message, it only waits with OverflowBlock when the queue is full.
+func (q *messageQueue) push(ctx context.Context, message []byte) error {
+	key := ""
+	if q.options.Policy == OverflowCoalesce && q.options.CoalesceKey != nil {
+		key = q.options.CoalesceKey(message)
+	}
+
+	for {
+		q.mux.Lock()
+
+		if entry, ok := q.keys[key]; ok && key != "" {
+			entry.message = message
+			q.dropped.Add(1)
+			q.mux.Unlock()
+			return nil
+		}
+
+		if len(q.entries) >= q.size() {
+			if q.options.Policy == OverflowBlock {
+				q.mux.Unlock()
+
+				select {
+				case <-q.space:
+					continue
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			q.dropOldest()
+		}
+
+		entry := &queueEntry{key: key, message: message}
+		q.entries = append(q.entries, entry)
+		if key != "" {
+			q.keys[key] = entry
+		}
+		q.mux.Unlock()
+
+		notify(q.ready)
+		return nil
+	}
+}
+
+// pop waits for the next message until the context is done.
+func (q *messageQueue) pop(ctx context.Context) ([]byte, bool) {
+	for {
+		q.mux.Lock()
+
+		if len(q.entries) > 0 {
+			entry := q.entries[0]
+			q.entries = q.entries[1:]
+			if q.keys[entry.key] == entry {
+				delete(q.keys, entry.key)
+			}
+			q.mux.Unlock()
+
+			notify(q.space)
+			return entry.message, true
+		}
+
+		q.mux.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (q *messageQueue) depth() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	return len(q.entries)
+}
+
+func newMessageQueue(options *QueueOptions, dropped *atomic.Uint64) *messageQueue {
+	return &messageQueue{
+		options: options,
+		dropped: dropped,
+		keys:    make(map[string]*queueEntry),
+		ready:   make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+	}
+}
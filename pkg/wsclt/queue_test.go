@@ -0,0 +1,155 @@
+package wsclt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func drainQueue(q *messageQueue) []string {
+	var messages []string
+	for q.depth() > 0 {
+		message, _ := q.pop(context.Background())
+		messages = append(messages, string(message))
+	}
+
+	return messages
+}
+
+func TestQueue_Policies(t *testing.T) {
+	ctx := context.Background()
+
+	var dropped atomic.Uint64
+	q := newMessageQueue(&QueueOptions{Size: 2, Policy: OverflowDropOldest}, &dropped)
+	for _, message := range []string{"a", "b", "c"} {
+		if err := q.push(ctx, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if messages := strings.Join(drainQueue(q), ","); messages != "b,c" || dropped.Load() != 1 {
+		t.Errorf("DropOldest Error: got %s with %d drops", messages, dropped.Load())
+	}
+
+	dropped.Store(0)
+	q = newMessageQueue(&QueueOptions{
+		Size:   2,
+		Policy: OverflowCoalesce,
+		CoalesceKey: func(message []byte) string {
+			return strings.Split(string(message), ":")[0]
+		},
+	}, &dropped)
+	for _, message := range []string{"btc:1", "eth:1", "btc:2", "ltc:1"} {
+		if err := q.push(ctx, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// btc:2 replaces btc:1 in place, then ltc:1 drops the oldest one.
+	if messages := strings.Join(drainQueue(q), ","); messages != "eth:1,ltc:1" || dropped.Load() != 2 {
+		t.Errorf("Coalesce Error: got %s with %d drops", messages, dropped.Load())
+	}
+
+	dropped.Store(0)
+	q = newMessageQueue(&QueueOptions{Size: 1, Policy: OverflowBlock}, &dropped)
+	if err := q.push(ctx, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if err := q.push(timeoutCtx, []byte("b")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Block Error: expected the push to wait, got %v", err)
+	}
+
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- q.push(ctx, []byte("c"))
+	}()
+
+	if message, ok := q.pop(ctx); !ok || string(message) != "a" {
+		t.Errorf("Block Error: expected a, got %s", message)
+	}
+
+	if err := <-pushed; err != nil {
+		t.Errorf("Block Error: %v", err)
+	}
+
+	if messages := strings.Join(drainQueue(q), ","); messages != "c" || dropped.Load() != 0 {
+		t.Errorf("Block Error: got %s with %d drops", messages, dropped.Load())
+	}
+}
+
+func TestClient_Queue(t *testing.T) {
+	server := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	entered := make(chan struct{}, 16)
+	release := make(chan struct{})
+	received := make(chan string, 16)
+
+	clt := NewClient(&Options{
+		PingInterval: time.Hour,
+		Queue:        &QueueOptions{Size: 2, Policy: OverflowDropOldest},
+		MessageHandler: func(msg []byte) {
+			entered <- struct{}{}
+			<-release
+			received <- string(msg)
+		},
+	})
+
+	if err := clt.Connect(context.Background(), url); err != nil {
+		t.Fatal(err)
+	}
+	defer clt.Close()
+
+	// The first message blocks the handler, the reader keeps reading into the queue.
+	if err := clt.SendMessage([]byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the handler")
+	}
+
+	for _, message := range []string{"2", "3", "4", "5"} {
+		if err := clt.SendMessage([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for clt.QueueDrops() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if depth := clt.QueueDepth(); depth != 2 {
+		t.Errorf("Expected queue depth 2, got %d", depth)
+	}
+
+	if drops := clt.QueueDrops(); drops != 2 {
+		t.Errorf("Expected 2 drops, got %d", drops)
+	}
+
+	close(release)
+
+	var messages []string
+	for len(messages) < 3 {
+		select {
+		case message := <-received:
+			messages = append(messages, message)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out, received %v", messages)
+		}
+	}
+
+	if strings.Join(messages, ",") != "1,4,5" {
+		t.Errorf("Expected 1,4,5, got %v", messages)
+	}
+}
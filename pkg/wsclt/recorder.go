@@ -0,0 +1,165 @@
+package wsclt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	DirectionInbound  = "in"
+	DirectionOutbound = "out"
+)
+
+// Recorder receives every raw frame read from or written to the connection.
+type Recorder interface {
+	Record(direction string, messageType int, message []byte)
+}
+
+// Frame is a recorded frame, Time is the monotonic time elapsed since the recording started.
+type Frame struct {
+	Time        time.Duration `json:"t"`
+	Direction   string        `json:"dir"`
+	MessageType int           `json:"type"`
+	Data        []byte        `json:"data"`
+}
+
+// FileRecorder writes the frames to a file as JSON lines.
+type FileRecorder struct {
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	start   time.Time
+	mux     sync.Mutex
+}
+
+func (r *FileRecorder) Record(direction string, messageType int, message []byte) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	// Recording is best effort, it should never break the connection.
+	_ = r.encoder.Encode(&Frame{
+		Time:        time.Since(r.start),
+		Direction:   direction,
+		MessageType: messageType,
+		Data:        message,
+	})
+}
+
+// Flush writes the buffered frames to the file.
+func (r *FileRecorder) Flush() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.writer.Flush()
+}
+
+func (r *FileRecorder) Close() error {
+	if err := r.Flush(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+
+	return r.file.Close()
+}
+
+func NewFileRecorder(path string) (*FileRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	return &FileRecorder{
+		file:    file,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+		start:   time.Now(),
+	}, nil
+}
+
+// Replayer feeds the inbound frames of a recording to a message handler.
+type Replayer struct {
+	// Speed scales the original intervals between the frames, e.g. 2 replays twice as fast.
+	// The frames are replayed without waiting if it is not positive.
+	Speed float64
+	// Decoder decompresses the binary frames as Options.Decoder does.
+	Decoder Decoder
+	// Heartbeat skips the recorded pongs and server pings as the client does, so they don't reach the handler.
+	Heartbeat Heartbeat
+}
+
+// Play replays the recording read from the reader until it ends or the context is done.
+func (r *Replayer) Play(ctx context.Context, reader io.Reader, handler func([]byte)) error {
+	decoder := json.NewDecoder(reader)
+	start := time.Now()
+
+	for {
+		var frame Frame
+		if err := decoder.Decode(&frame); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if frame.Direction != DirectionInbound {
+			continue
+		}
+
+		if r.Speed > 0 {
+			wait := time.Duration(float64(frame.Time)/r.Speed) - time.Since(start)
+			if wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		message, messageType := frame.Data, frame.MessageType
+		if messageType == websocket.BinaryMessage && r.Decoder != nil {
+			var err error
+			if message, err = r.Decoder(message); err != nil {
+				continue
+			}
+
+			// The decompressed payloads are texts, so the heartbeat can match them as usual.
+			messageType = websocket.TextMessage
+		}
+
+		if r.Heartbeat != nil {
+			if r.Heartbeat.IsPong(messageType, message) {
+				continue
+			}
+
+			if _, ok := r.Heartbeat.Reply(messageType, message); ok {
+				continue
+			}
+		}
+
+		handler(message)
+	}
+}
+
+// PlayFile replays the recording file.
+func (r *Replayer) PlayFile(ctx context.Context, path string, handler func([]byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return r.Play(ctx, file, handler)
+}